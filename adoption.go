@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
+)
+
+type adoptionConfig struct {
+	gf      string
+	dir     string
+	format  string
+	output  string
+	laxMode bool
+}
+
+// adoptionReport holds the results of tracking the adoption of a geofeed
+// across builds of an MMDB.
+type adoptionReport struct {
+	result verify.AdoptionResult
+	// rows holds the valid rows, in geofeed order.
+	rows []verify.AdoptionRowResult
+}
+
+func runAdoption(program string, args []string) error {
+	conf, output, err := parseAdoptionFlags(program, args)
+	if err != nil {
+		fmt.Println(output)
+		return &usageError{err: err}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	rep := &adoptionReport{}
+	rep.result, err = verify.TrackAdoption(
+		ctx,
+		conf.gf,
+		conf.dir,
+		verify.Options{LaxMode: conf.laxMode},
+		func(r verify.AdoptionRowResult) error {
+			if r.Err == nil {
+				rep.rows = append(rep.rows, r)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		if errors.Is(err, verify.ErrInvalidGeofeed) {
+			logInvalidRows(verify.CheckResult{
+				Total:             rep.result.Total,
+				Invalid:           rep.result.Invalid,
+				SampleInvalidRows: rep.result.SampleInvalidRows,
+			})
+		}
+		return fmt.Errorf("unable to track the adoption of geofeed %s: %w", conf.gf, err)
+	}
+
+	return writeOutput(conf.output, func(w io.Writer) error {
+		if conf.format == "csv" {
+			return writeAdoptionCSV(w, rep)
+		}
+		writeAdoptionText(w, rep)
+		return nil
+	})
+}
+
+// build describes the i-th MMDB by its path and build date.
+func (r *adoptionReport) build(i int) string {
+	return fmt.Sprintf(
+		"%s (built %s)",
+		r.result.MMDBs[i],
+		r.result.Databases[i].Database.BuildTime().Format(time.DateOnly),
+	)
+}
+
+func writeAdoptionText(w io.Writer, rep *adoptionReport) {
+	var unadopted []verify.AdoptionRowResult
+	for _, row := range rep.rows {
+		if !row.Adopted() {
+			unadopted = append(unadopted, row)
+			continue
+		}
+		c := row.Comparison
+		fmt.Fprintf(
+			w,
+			"Line %d: '%s', suggested: '%s', first matched in %s\n",
+			row.Line,
+			c.Network,
+			c.Suggested,
+			rep.build(row.FirstMatch),
+		)
+	}
+
+	if len(unadopted) > 0 {
+		fmt.Fprintf(w, "\nNot adopted in %s:\n", rep.build(len(rep.result.MMDBs)-1))
+	}
+	for _, row := range unadopted {
+		c := row.Comparison
+		fmt.Fprintf(
+			w,
+			"Line %d: '%s', suggested: '%s', current: '%s'",
+			row.Line,
+			c.Network,
+			c.Suggested,
+			c.Current,
+		)
+		if row.FirstMatch >= 0 {
+			fmt.Fprintf(w, ", matched in %s", rep.build(row.FirstMatch))
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(
+		w,
+		"\nOut of %d potential corrections, %d have not been adopted as of the latest "+
+			"of %d MMDBs\n",
+		rep.result.Total,
+		rep.result.Unadopted,
+		len(rep.result.MMDBs),
+	)
+}
+
+// adoptionCSVHeader is the header of the adoption CSV output. The current
+// location is that of the latest MMDB.
+var adoptionCSVHeader = []string{
+	"network",
+	"line",
+	"adopted",
+	"first_match_mmdb",
+	"first_match_build_time",
+	"current_country",
+	"suggested_country",
+	"current_region",
+	"suggested_region",
+	"current_city",
+	"suggested_city",
+	"current_postal_code",
+	"suggested_postal_code",
+}
+
+// writeAdoptionCSV writes a CSV row for each valid geofeed row.
+func writeAdoptionCSV(w io.Writer, rep *adoptionReport) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(adoptionCSVHeader); err != nil {
+		return err
+	}
+	for _, row := range rep.rows {
+		c := row.Comparison
+		var mmdb, buildTime string
+		if row.FirstMatch >= 0 {
+			mmdb = rep.result.MMDBs[row.FirstMatch]
+			buildTime = rep.result.Databases[row.FirstMatch].Database.BuildTime().
+				Format(time.RFC3339)
+		}
+		err := csvWriter.Write(csvSafe([]string{
+			c.Network,
+			strconv.Itoa(row.Line),
+			strconv.FormatBool(row.Adopted()),
+			mmdb,
+			buildTime,
+			c.Current.Country,
+			c.Suggested.Country,
+			c.Current.Region,
+			c.Suggested.Region,
+			c.Current.City,
+			c.Suggested.City,
+			c.Current.PostalCode,
+			c.Suggested.PostalCode,
+		}))
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func parseAdoptionFlags(
+	program string,
+	args []string,
+) (c *adoptionConfig, output string, err error) {
+	flags := flag.NewFlagSet(program, flag.ContinueOnError)
+	var buf bytes.Buffer
+	flags.SetOutput(&buf)
+
+	var conf adoptionConfig
+	flags.StringVar(&conf.gf, "gf", "", "Path to local geofeed file to track")
+	flags.StringVar(
+		&conf.dir,
+		"dir",
+		"",
+		"Path to a directory of City or Country MMDB files, e.g., successive builds; "+
+			"they are ordered by build time")
+	flags.StringVar(&conf.format, "format", "text", "Output format: text or csv")
+	flags.StringVar(&conf.output, "o", "", "Path to write the output to (default: stdout)")
+	flags.BoolVar(
+		&conf.laxMode,
+		"lax",
+		false,
+		"Enable lax mode: geofeed's region code may be provided without country code prefix")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return nil, buf.String(), err
+	}
+
+	if conf.gf == "" || conf.dir == "" {
+		flags.PrintDefaults()
+		return nil, buf.String(), errors.New("-gf and -dir are required")
+	}
+
+	if conf.format != "text" && conf.format != "csv" {
+		flags.PrintDefaults()
+		return nil, buf.String(), fmt.Errorf("unknown format %q", conf.format)
+	}
+
+	return &conf, buf.String(), nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
+)
+
+type compileConfig struct {
+	gf      string
+	db      string
+	output  string
+	laxMode bool
+}
+
+func runCompile(program string, args []string) error {
+	conf, output, err := parseCompileFlags(program, args)
+	if err != nil {
+		fmt.Println(output)
+		return &usageError{err: err}
+	}
+
+	c, err := compileGeofeed(conf)
+	if err != nil {
+		if errors.Is(err, verify.ErrInvalidGeofeed) {
+			logInvalidRows(c)
+		}
+		return fmt.Errorf("unable to compile geofeed %s: %w", conf.gf, err)
+	}
+
+	fmt.Printf("Compiled %d rows into %s\n", c.Total, conf.output)
+	return nil
+}
+
+// compileGeofeed writes the MMDB to a temporary file next to conf.output and
+// renames it into place once it is complete, so that the base MMDB may be
+// overwritten and a failed compilation does not leave a partial MMDB.
+func compileGeofeed(conf *compileConfig) (verify.CheckResult, error) {
+	output := filepath.Clean(conf.output)
+	f, err := os.CreateTemp(filepath.Dir(output), "."+filepath.Base(output)+".*.tmp")
+	if err != nil {
+		return verify.CheckResult{}, fmt.Errorf("unable to create %s: %w", conf.output, err)
+	}
+
+	// os.CreateTemp creates the file readable only by its owner.
+	err = f.Chmod(0o644) //nolint:gosec // MMDBs are meant to be shared
+	if err != nil {
+		f.Close()
+		return verify.CheckResult{}, cleanUpTemp(f.Name(), err)
+	}
+
+	c, err := verify.CompileGeofeed(
+		conf.gf,
+		conf.db,
+		f,
+		verify.Options{LaxMode: conf.laxMode},
+	)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), output)
+	}
+	if err != nil {
+		return c, cleanUpTemp(f.Name(), err)
+	}
+	return c, nil
+}
+
+// cleanUpTemp removes the temporary file after err occurred, returning err
+// joined with the error removing the file, if any.
+func cleanUpTemp(filename string, err error) error {
+	if removeErr := os.Remove(filename); removeErr != nil {
+		return errors.Join(err, removeErr)
+	}
+	return err
+}
+
+func parseCompileFlags(
+	program string,
+	args []string,
+) (c *compileConfig, output string, err error) {
+	flags := flag.NewFlagSet(program, flag.ContinueOnError)
+	var buf bytes.Buffer
+	flags.SetOutput(&buf)
+
+	var conf compileConfig
+	flags.StringVar(&conf.gf, "gf", "", "Path to local geofeed file to compile")
+	flags.StringVar(
+		&conf.db,
+		"db",
+		"",
+		"Path to City MMDB file to overlay the geofeed on (optional; if omitted, a standalone MMDB is written)",
+	)
+	flags.StringVar(&conf.output, "o", "", "Path to write the MMDB to")
+	flags.BoolVar(
+		&conf.laxMode,
+		"lax",
+		false,
+		"Enable lax mode: geofeed's region code may be provided without country code prefix")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return nil, buf.String(), err
+	}
+
+	if conf.gf == "" || conf.output == "" {
+		flags.PrintDefaults()
+		return nil, buf.String(), errors.New("-gf and -o are required")
+	}
+
+	return &conf, buf.String(), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
+)
+
+// csvHeader is the header of the CSV output.
+var csvHeader = []string{
+	"network",
+	"line",
+	"differences",
+	"current_country",
+	"suggested_country",
+	"current_region",
+	"suggested_region",
+	"region_match",
+	"region_level",
+	"current_city",
+	"suggested_city",
+	"city_match",
+	"city_locale",
+	"current_postal_code",
+	"suggested_postal_code",
+	"distance_km",
+	"accuracy_radius_km",
+	"as_number",
+	"as_organization",
+	"isp",
+}
+
+// writeCSV writes a CSV row for each geofeed row that differs from the MMDB,
+// with the current and suggested value of each field.
+func writeCSV(w io.Writer, rep *report) error {
+	return writeRows(newCSVWriter(w), rep)
+}
+
+// csvWriter writes the CSV output as the rows are verified.
+type csvWriter struct {
+	w *csv.Writer
+	// headerErr is the error writing the header, if any.
+	headerErr error
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	cw.headerErr = cw.w.Write(csvHeader)
+	return cw
+}
+
+func (cw *csvWriter) writeRow(r verify.RowResult) error {
+	if cw.headerErr != nil {
+		return cw.headerErr
+	}
+	c := r.Comparison
+	if r.Diff == "" || c == nil {
+		return nil
+	}
+
+	differences := make([]string, 0, len(c.Differences))
+	for _, f := range c.Differences {
+		differences = append(differences, f.String())
+	}
+	// The match columns are left empty for the fields that the MMDB does not
+	// provide, e.g., the region and city of Country databases.
+	regionMatch, regionLevel := "", ""
+	if slices.Contains(c.Fields, verify.RegionField) {
+		regionMatch = c.RegionMatch.String()
+		if c.RegionLevel > 0 {
+			regionLevel = strconv.Itoa(c.RegionLevel)
+		}
+	}
+	cityMatch := ""
+	if slices.Contains(c.Fields, verify.CityField) {
+		cityMatch = c.CityMatch.String()
+	}
+	distance, accuracyRadius := "", ""
+	if c.Distance != nil {
+		distance = strconv.FormatFloat(*c.Distance, 'f', 1, 64)
+		accuracyRadius = strconv.Itoa(int(c.AccuracyRadius))
+	}
+	asNumber := ""
+	if c.ASNumber > 0 {
+		asNumber = strconv.FormatUint(uint64(c.ASNumber), 10)
+	}
+
+	return cw.w.Write(csvSafe([]string{
+		c.Network,
+		strconv.Itoa(r.Line),
+		strings.Join(differences, ";"),
+		c.Current.Country,
+		c.Suggested.Country,
+		c.Current.Region,
+		c.Suggested.Region,
+		regionMatch,
+		regionLevel,
+		c.Current.City,
+		c.Suggested.City,
+		cityMatch,
+		c.CityLocale,
+		c.Current.PostalCode,
+		c.Suggested.PostalCode,
+		distance,
+		accuracyRadius,
+		asNumber,
+		c.ASOrganization,
+		c.ISP,
+	}))
+}
+
+func (cw *csvWriter) finish(*report) error {
+	if cw.headerErr != nil {
+		return cw.headerErr
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// csvFormulaPrefixes are the characters that make spreadsheet applications
+// evaluate a cell as a formula.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvSafe prefixes the values of a CSV record that spreadsheet applications
+// would evaluate as formulas with a single quote, so that they are displayed
+// as text. The values come from the geofeed and the MMDBs and may not be
+// trusted.
+func csvSafe(record []string) []string {
+	for i, v := range record {
+		if v != "" && strings.IndexByte(csvFormulaPrefixes, v[0]) >= 0 {
+			record[i] = "'" + v
+		}
+	}
+	return record
+}
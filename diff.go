@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
+)
+
+type diffConfig struct {
+	oldGF   string
+	newGF   string
+	format  string
+	laxMode bool
+}
+
+// diffReport is the JSON representation of a geofeed diff.
+type diffReport struct {
+	OldRows   int                  `json:"old_rows"`
+	NewRows   int                  `json:"new_rows"`
+	Added     int                  `json:"added"`
+	Removed   int                  `json:"removed"`
+	Relocated int                  `json:"relocated"`
+	Changes   []verify.RangeChange `json:"changes"`
+}
+
+func runDiff(program string, args []string) error {
+	conf, output, err := parseDiffFlags(program, args)
+	if err != nil {
+		fmt.Println(output)
+		return &usageError{err: err}
+	}
+
+	d, err := verify.DiffGeofeeds(
+		conf.oldGF,
+		conf.newGF,
+		verify.Options{LaxMode: conf.laxMode},
+	)
+	if err != nil {
+		if errors.Is(err, verify.ErrInvalidGeofeed) {
+			for _, c := range []verify.CheckResult{d.Old, d.New} {
+				if c.Invalid > 0 {
+					logInvalidRows(c)
+				}
+			}
+		}
+		return fmt.Errorf("unable to diff %s and %s: %w", conf.oldGF, conf.newGF, err)
+	}
+
+	if conf.format == "json" {
+		return writeDiffJSON(os.Stdout, d)
+	}
+	writeDiffText(os.Stdout, d)
+	return nil
+}
+
+func newDiffReport(d verify.DiffResult) diffReport {
+	r := diffReport{
+		OldRows: d.Old.Total,
+		NewRows: d.New.Total,
+		Changes: d.Changes,
+	}
+	if r.Changes == nil {
+		r.Changes = []verify.RangeChange{}
+	}
+	for _, change := range d.Changes {
+		switch change.Kind {
+		case verify.Added:
+			r.Added++
+		case verify.Removed:
+			r.Removed++
+		case verify.Relocated:
+			r.Relocated++
+		}
+	}
+	return r
+}
+
+func writeDiffJSON(w io.Writer, d verify.DiffResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newDiffReport(d))
+}
+
+func writeDiffText(w io.Writer, d verify.DiffResult) {
+	for _, change := range d.Changes {
+		fmt.Fprintf(w, "%s\n\n", change)
+	}
+	r := newDiffReport(d)
+	fmt.Fprintf(
+		w,
+		"Compared %d rows against %d rows. Address ranges added: %d, removed: %d, relocated: %d\n",
+		r.OldRows,
+		r.NewRows,
+		r.Added,
+		r.Removed,
+		r.Relocated,
+	)
+}
+
+func parseDiffFlags(program string, args []string) (c *diffConfig, output string, err error) {
+	flags := flag.NewFlagSet(program, flag.ContinueOnError)
+	var buf bytes.Buffer
+	flags.SetOutput(&buf)
+
+	var conf diffConfig
+	flags.StringVar(&conf.oldGF, "old", "", "Path to the previous version of the geofeed")
+	flags.StringVar(&conf.newGF, "new", "", "Path to the new version of the geofeed")
+	flags.StringVar(&conf.format, "format", "text", "Output format: text or json")
+	flags.BoolVar(
+		&conf.laxMode,
+		"lax",
+		false,
+		"Enable lax mode: geofeed's region code may be provided without country code prefix")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return nil, buf.String(), err
+	}
+
+	if conf.oldGF == "" || conf.newGF == "" {
+		flags.PrintDefaults()
+		return nil, buf.String(), errors.New("-old and -new are required")
+	}
+
+	if conf.format != "text" && conf.format != "json" {
+		flags.PrintDefaults()
+		return nil, buf.String(), fmt.Errorf("unknown format %q", conf.format)
+	}
+
+	return &conf, buf.String(), nil
+}
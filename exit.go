@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"io/fs"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+
+	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
+)
+
+// Exit codes. These are documented in the README and changing them should be
+// considered a breaking change.
+const (
+	exitOK = 0
+	// exitFailure is used for errors that do not fall into any of the
+	// classes below.
+	exitFailure = 1
+	// exitUsage indicates invalid command-line arguments.
+	exitUsage = 2
+	// exitIO indicates that a file could not be read or written, or that an
+	// MMDB could not be opened or is of the wrong type.
+	exitIO = 3
+	// exitEncoding indicates a geofeed that is not valid UTF-8.
+	exitEncoding = 4
+	// exitInvalid indicates a geofeed with invalid rows or that is not valid
+	// CSV.
+	exitInvalid = 5
+	// exitEmpty indicates a geofeed without rows (unless -empty-ok is used).
+	exitEmpty = 6
+	// exitDifferences indicates that the geofeed differs from the MMDB. It is
+	// only used with -fail-on-diff.
+	exitDifferences = 7
+	// exitInterrupted indicates that processing was interrupted.
+	exitInterrupted = 130
+)
+
+// errDifferences is returned with -fail-on-diff if the geofeed differs from
+// the MMDB.
+var errDifferences = errors.New("geofeed differs from the MMDB")
+
+// usageError indicates invalid command-line arguments.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// inputFileError indicates that an input file other than the geofeed, e.g., a
+// gazetteer, could not be read or is malformed.
+type inputFileError struct {
+	err error
+}
+
+func (e *inputFileError) Error() string {
+	return e.err.Error()
+}
+
+func (e *inputFileError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns the exit code for an error returned by run.
+func exitCode(err error) int {
+	var (
+		pathErr  *fs.PathError
+		parseErr *csv.ParseError
+		dbErr    maxminddb.InvalidDatabaseError
+		usageErr *usageError
+		inputErr *inputFileError
+	)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usageErr), errors.Is(err, verify.ErrNoMMDB):
+		return exitUsage
+	case errors.As(err, &inputErr):
+		return exitIO
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, verify.ErrNotUTF8):
+		return exitEncoding
+	case errors.Is(err, verify.ErrInvalidGeofeed), errors.As(err, &parseErr):
+		return exitInvalid
+	case errors.Is(err, verify.ErrEmptyGeofeed):
+		return exitEmpty
+	case errors.Is(err, errDifferences):
+		return exitDifferences
+	case errors.As(err, &pathErr), errors.As(err, &dbErr),
+		errors.Is(err, verify.ErrUnsupportedDatabase):
+		return exitIO
+	default:
+		return exitFailure
+	}
+}
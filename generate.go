@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
+)
+
+type generateConfig struct {
+	prefixes string
+	db       string
+	output   string
+}
+
+func runGenerate(program string, args []string) error {
+	conf, output, err := parseGenerateFlags(program, args)
+	if err != nil {
+		fmt.Println(output)
+		return &usageError{err: err}
+	}
+
+	prefixes, err := readPrefixes(conf.prefixes)
+	if err != nil {
+		return err
+	}
+
+	entries, err := verify.GenerateGeofeed(prefixes, conf.db, verify.Options{})
+	if err != nil {
+		return fmt.Errorf("unable to generate geofeed: %w", err)
+	}
+
+	if conf.output == "" {
+		return verify.WriteGeofeed(os.Stdout, entries)
+	}
+
+	f, err := os.Create(filepath.Clean(conf.output))
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", conf.output, err)
+	}
+	err = verify.WriteGeofeed(f, entries)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %w", conf.output, err)
+	}
+	return nil
+}
+
+// readPrefixes reads a list of prefixes, one per line. Only the first
+// comma-separated field of each line is used, so an allocation list in CSV
+// format or an existing geofeed may be used as well. Comments starting with
+// '#' and blank lines are ignored. A single IP address is treated as a network
+// of its own.
+func readPrefixes(filename string) ([]netip.Prefix, error) {
+	f, err := os.Open(filepath.Clean(filename))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %w", filename, err)
+	}
+	defer f.Close()
+
+	return parsePrefixes(f, filename)
+}
+
+func parsePrefixes(r io.Reader, filename string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text, _, _ = strings.Cut(text, ",")
+		text = strings.TrimSpace(strings.TrimPrefix(text, "\ufeff"))
+		if text == "" {
+			continue
+		}
+
+		var (
+			prefix netip.Prefix
+			err    error
+		)
+		if strings.Contains(text, "/") {
+			prefix, err = netip.ParsePrefix(text)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(text)
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid prefix: %w", filename, line, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", filename, err)
+	}
+	return prefixes, nil
+}
+
+func parseGenerateFlags(
+	program string,
+	args []string,
+) (c *generateConfig, output string, err error) {
+	flags := flag.NewFlagSet(program, flag.ContinueOnError)
+	var buf bytes.Buffer
+	flags.SetOutput(&buf)
+
+	var conf generateConfig
+	flags.StringVar(
+		&conf.prefixes,
+		"prefixes",
+		"",
+		"Path to a list of prefixes, one per line (only the first CSV field is used)",
+	)
+	flags.StringVar(&conf.db, "db", "", "Path to City MMDB file to generate the geofeed from")
+	flags.StringVar(&conf.output, "o", "", "Path to write the geofeed to (default: stdout)")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return nil, buf.String(), err
+	}
+
+	if conf.prefixes == "" || conf.db == "" {
+		flags.PrintDefaults()
+		return nil, buf.String(), errors.New("-prefixes and -db are required")
+	}
+
+	return &conf, buf.String(), nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"slices"
+
+	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
+)
+
+type htmlData struct {
+	Geofeed     string
+	Compared    bool
+	Empty       bool
+	Total       int
+	Differences int
+	Invalid     int
+	ByField     []htmlCount
+	ByCountry   []htmlCount
+	ByASN       []htmlASNCount
+	Rows        []htmlDifference
+	InvalidRows []*verify.RowError
+	Databases   []database
+}
+
+type htmlCount struct {
+	Key   string
+	Count int
+}
+
+type htmlASNCount struct {
+	ASNumber       uint
+	ASOrganization string
+	Count          int
+}
+
+type htmlDifference struct {
+	Line           int
+	Network        string
+	Fields         []htmlField
+	ASNumber       uint
+	ASOrganization string
+	ISP            string
+}
+
+type htmlField struct {
+	Current   string
+	Suggested string
+	Differs   bool
+}
+
+// writeHTML writes the report as a self-contained HTML document.
+func writeHTML(w io.Writer, rep *report) error {
+	data := htmlData{
+		Geofeed:     rep.geofeed,
+		Compared:    rep.compared,
+		Empty:       rep.empty,
+		Total:       rep.result.Total,
+		Differences: rep.result.Differences,
+		Invalid:     rep.result.Invalid,
+		Databases:   rep.databases(),
+	}
+	for _, c := range rep.differencesByField() {
+		data.ByField = append(data.ByField, htmlCount{Key: c.key, Count: c.n})
+	}
+	for _, c := range rep.differencesByCountry() {
+		data.ByCountry = append(data.ByCountry, htmlCount{Key: c.key, Count: c.n})
+	}
+	for _, c := range rep.differencesByASN() {
+		data.ByASN = append(data.ByASN, htmlASNCount{
+			ASNumber:       c.asNumber,
+			ASOrganization: c.asOrganization,
+			Count:          c.n,
+		})
+	}
+	for _, r := range rep.rows {
+		if r.Err != nil {
+			data.InvalidRows = append(data.InvalidRows, r.Err)
+			continue
+		}
+		d := htmlDifference{
+			Line:           r.Line,
+			Network:        r.Comparison.Network,
+			ASNumber:       r.Comparison.ASNumber,
+			ASOrganization: r.Comparison.ASOrganization,
+			ISP:            r.Comparison.ISP,
+		}
+		for _, f := range locationFields {
+			d.Fields = append(d.Fields, htmlField{
+				Current:   r.Comparison.Current.Value(f),
+				Suggested: r.Comparison.Suggested.Value(f),
+				Differs:   slices.Contains(r.Comparison.Differences, f),
+			})
+		}
+		data.Rows = append(data.Rows, d)
+	}
+	return htmlTemplate.Execute(w, data)
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Geofeed report: {{.Geofeed}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.2em; margin-top: 2em; }
+.counters { display: flex; gap: 1em; flex-wrap: wrap; }
+.counter { border: 1px solid #ccc; border-radius: 4px; padding: 0.5em 1em; min-width: 8em; }
+.counter .value { font-size: 1.8em; font-weight: bold; }
+.summary { display: flex; gap: 2em; flex-wrap: wrap; align-items: flex-start; }
+table { border-collapse: collapse; margin-top: 0.5em; }
+th, td { border: 1px solid #ddd; padding: 0.25em 0.5em; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; cursor: pointer; user-select: none; }
+th[data-order="asc"]::after { content: " \25B2"; }
+th[data-order="desc"]::after { content: " \25BC"; }
+td.num { text-align: right; }
+td.diff { background: #fff4e0; }
+del { color: #a00; }
+ins { color: #070; text-decoration: none; }
+input.filter { margin-top: 0.5em; padding: 0.25em; width: 20em; }
+.notice { padding: 0.5em 1em; background: #fdecea; border: 1px solid #f5c2c0; }
+</style>
+</head>
+<body>
+<h1>Geofeed report: {{.Geofeed}}</h1>
+<div class="counters">
+<div class="counter"><div class="value">{{.Total}}</div>rows</div>
+{{- if .Compared}}
+<div class="counter"><div class="value">{{.Differences}}</div>differences</div>
+{{- end}}
+<div class="counter"><div class="value">{{.Invalid}}</div>invalid rows</div>
+</div>
+{{- if .Empty}}
+<p class="notice">The geofeed is empty.</p>
+{{- end}}
+{{- if not .Compared}}
+<p>No MMDB was provided, so the geofeed was not compared against one.</p>
+{{- end}}
+{{- if .Databases}}
+<h2>Databases</h2>
+<table>
+<thead><tr><th>Database</th><th>Type</th><th>Built</th><th>IP version</th><th>Languages</th></tr></thead>
+<tbody>
+{{- range .Databases}}
+<tr><td>{{.Role}}</td><td>{{.DatabaseType}}</td><td>{{.BuildTime.Format "2006-01-02 15:04:05 MST"}}</td><td class="num">{{.IPVersion}}</td><td>{{range $i, $l := .Languages}}{{if $i}}, {{end}}{{$l}}{{end}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+{{- if .Rows}}
+<h2>Differences by field, country and ASN</h2>
+<div class="summary">
+<table class="sortable">
+<thead><tr><th>Field</th><th class="num">Differences</th></tr></thead>
+<tbody>
+{{- range .ByField}}
+<tr><td>{{.Key}}</td><td class="num">{{.Count}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+<table class="sortable">
+<thead><tr><th>Suggested country</th><th class="num">Differences</th></tr></thead>
+<tbody>
+{{- range .ByCountry}}
+<tr><td>{{.Key}}</td><td class="num">{{.Count}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- if .ByASN}}
+<table class="sortable">
+<thead><tr><th class="num">ASN</th><th>AS organization</th><th class="num">Differences</th></tr></thead>
+<tbody>
+{{- range .ByASN}}
+<tr><td class="num">{{.ASNumber}}</td><td>{{.ASOrganization}}</td><td class="num">{{.Count}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+</div>
+<h2>Differences</h2>
+<input class="filter" type="search" placeholder="Filter differences" data-table="differences">
+<table id="differences" class="sortable">
+<thead><tr>
+<th class="num">Line</th><th>Network</th><th>Country</th><th>Region</th><th>City</th><th>Postal code</th>
+<th class="num">ASN</th><th>AS organization</th><th>ISP</th>
+</tr></thead>
+<tbody>
+{{- range .Rows}}
+<tr>
+<td class="num">{{.Line}}</td><td>{{.Network}}</td>
+{{- range .Fields}}
+{{- if .Differs}}
+<td class="diff"><del>{{.Current}}</del> <ins>{{.Suggested}}</ins></td>
+{{- else}}
+<td>{{.Suggested}}</td>
+{{- end}}
+{{- end}}
+<td class="num">{{if .ASNumber}}{{.ASNumber}}{{end}}</td><td>{{.ASOrganization}}</td><td>{{.ISP}}</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+{{- if .InvalidRows}}
+<h2>Invalid rows</h2>
+<input class="filter" type="search" placeholder="Filter invalid rows" data-table="invalid">
+<table id="invalid" class="sortable">
+<thead><tr><th class="num">Line</th><th class="num">Column</th><th>Type</th><th>Value</th><th>Reason</th></tr></thead>
+<tbody>
+{{- range .InvalidRows}}
+<tr><td class="num">{{.Line}}</td><td class="num">{{if .Column}}{{.Column}}{{end}}</td><td>{{.Invalidity}}</td><td>{{.Value}}</td><td>{{.Reason}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+<script>
+document.querySelectorAll("table.sortable th").forEach(function (th) {
+  th.addEventListener("click", function () {
+    var table = th.closest("table");
+    var tbody = table.tBodies[0];
+    var index = th.cellIndex;
+    var asc = th.dataset.order !== "asc";
+    table.querySelectorAll("th").forEach(function (h) { delete h.dataset.order; });
+    th.dataset.order = asc ? "asc" : "desc";
+    var numeric = th.classList.contains("num");
+    var rows = Array.prototype.slice.call(tbody.rows);
+    rows.sort(function (a, b) {
+      var x = a.cells[index].textContent;
+      var y = b.cells[index].textContent;
+      var c = numeric ? (Number(x) || 0) - (Number(y) || 0) : x.localeCompare(y);
+      return asc ? c : -c;
+    });
+    rows.forEach(function (row) { tbody.appendChild(row); });
+  });
+});
+document.querySelectorAll("input.filter").forEach(function (input) {
+  input.addEventListener("input", function () {
+    var query = input.value.toLowerCase();
+    var rows = document.getElementById(input.dataset.table).tBodies[0].rows;
+    Array.prototype.forEach.call(rows, function (row) {
+      row.hidden = row.textContent.toLowerCase().indexOf(query) === -1;
+    });
+  });
+});
+</script>
+</body>
+</html>
+`))
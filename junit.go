@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
+)
+
+// The types below describe the commonly supported subset of the JUnit XML
+// format.
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnit writes the report as a JUnit XML test suite with a test case for
+// each rule. A rule's test case fails if any row violates it, listing those
+// rows. Differences from the MMDB are listed in the output of their test case
+// but do not make it fail.
+func writeJUnit(w io.Writer, rep *report) error {
+	failing := map[string][]string{}
+	var differences []string
+	for _, r := range rep.rows {
+		if r.Err != nil {
+			id := r.Err.Invalidity.String()
+			failing[id] = append(failing[id], r.Err.Error())
+			continue
+		}
+		differences = append(differences, fmt.Sprintf("line %d: %s", r.Line, diffMessage(r.Diff)))
+	}
+	if rep.empty {
+		failing[emptyGeofeedRule] = []string{"The geofeed is empty"}
+	}
+	invalidCounts := map[string]int{}
+	for invalidity, n := range rep.invalidCounts {
+		invalidCounts[invalidity.String()] = n
+	}
+
+	suite := junitTestSuite{Name: rep.geofeed}
+	for _, db := range rep.databases() {
+		suite.Properties = append(suite.Properties, junitProperty{
+			Name:  db.Role,
+			Value: db.DatabaseInfo.String(),
+		})
+	}
+	for _, r := range rules {
+		tc := junitTestCase{ClassName: rep.geofeed, Name: r.id}
+		switch {
+		case r.id == differenceRule:
+			if !rep.compared {
+				tc.Skipped = &junitSkipped{Message: "No MMDB provided"}
+				break
+			}
+			if len(differences) > 0 {
+				if n := rep.result.Differences - len(differences); n > 0 {
+					differences = append(differences, fmt.Sprintf("%d more rows not listed", n))
+				}
+				tc.SystemOut = &junitOutput{Text: strings.Join(differences, "\n\n")}
+			}
+		case max(len(failing[r.id]), invalidCounts[r.id]) > 0:
+			rows := failing[r.id]
+			// Only the first rows are kept for large geofeeds, but all the
+			// invalid rows are counted.
+			count := max(len(rows), invalidCounts[r.id])
+			if n := count - len(rows); n > 0 {
+				rows = append(rows, fmt.Sprintf("%d more rows not listed", n))
+			}
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%s (rows: %d)", r.description, count),
+				Type:    r.id,
+				Text:    strings.Join(rows, "\n"),
+			}
+		case !rep.compared && r.id == verify.UnableToFindCityRecord.String():
+			tc.Skipped = &junitSkipped{Message: "No MMDB provided"}
+		case !rep.comparedISP && r.id == verify.UnableToFindISPRecord.String():
+			tc.Skipped = &junitSkipped{Message: "No ISP MMDB provided"}
+		}
+
+		suite.Tests++
+		if tc.Failure != nil {
+			suite.Failures++
+		}
+		if tc.Skipped != nil {
+			suite.Skipped++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err := enc.Encode(junitTestSuites{
+		Name:     "mm-geofeed-verifier",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Suites:   []junitTestSuite{suite},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -6,18 +6,31 @@
 // Beyond verifying that the format of the data is correct, the script will also compare
 // the corrections against a given MMDB, reporting on how many corrections differ from
 // the contents in the database.
+// The diff command compares two versions of a geofeed, reporting the address
+// ranges that were added, removed or relocated. The generate command writes a
+// geofeed for a list of prefixes based on the contents of an MMDB, the
+// compile command writes an MMDB with the locations from a geofeed, and the
+// adoption command reports the first of a series of MMDB builds to match each
+// correction.
 package main
 
 import (
 	"bytes"
-	"cmp"
+	"context"
+	"encoding/csv"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"maps"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
 )
@@ -27,81 +40,250 @@ import (
 var version = "unknown"
 
 type config struct {
-	gf      string
-	db      string
-	isp     string
-	laxMode bool
-	emptyOK bool
+	gf string
+	// db holds the paths to the MMDBs to compare against, in the order
+	// given.
+	db          stringList
+	isp         string
+	laxMode     bool
+	emptyOK     bool
+	progress    bool
+	concurrency int
+	format      string
+	output      string
+	failOnDiff  bool
+	exactCity   bool
+	// cityEquivalents is the path to a CSV file of equivalent city names.
+	cityEquivalents string
+	locale          string
+	// gazetteer is the path to a CSV file of city coordinates.
+	gazetteer   string
+	minDistance float64
+	// maxDBAge is the age above which a warning is printed for an MMDB.
+	maxDBAge time.Duration
 }
 
 func main() {
 	err := run()
-	if err != nil {
-		log.Fatal(err)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		log.Print(err)
 	}
+	//nolint:revive // the exit code depends on the error
+	os.Exit(exitCode(err))
 }
 
 func run() error {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			return runDiff(os.Args[0]+" diff", os.Args[2:])
+		case "generate":
+			return runGenerate(os.Args[0]+" generate", os.Args[2:])
+		case "compile":
+			return runCompile(os.Args[0]+" compile", os.Args[2:])
+		case "adoption":
+			return runAdoption(os.Args[0]+" adoption", os.Args[2:])
+		}
+	}
+
 	conf, output, err := parseFlags(os.Args[0], os.Args[1:])
 	if err != nil {
 		fmt.Println(output)
-		return err
+		return &usageError{err: err}
 	}
 
-	if conf.db == "" && conf.isp != "" {
+	if len(conf.db) == 0 && conf.isp != "" {
 		fmt.Fprintln(os.Stderr, "-isp is ignored without -db")
 	}
 
-	c, diffLines, asnCounts, err := verify.ProcessGeofeed(
-		conf.gf,
-		conf.db,
-		conf.isp,
-		verify.Options{LaxMode: conf.laxMode, EmptyOK: conf.emptyOK},
-	)
-	if err != nil {
-		if errors.Is(err, verify.ErrInvalidGeofeed) {
-			log.Printf(
-				"Found %d invalid rows out of %d rows in total, examples by type:",
-				c.Invalid,
-				c.Total,
-			)
-			for invType, invMessage := range c.SampleInvalidRows {
-				log.Printf("%s: '%s'", invType, invMessage)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := verify.Options{
+		LaxMode:        conf.laxMode,
+		EmptyOK:        conf.emptyOK,
+		Concurrency:    conf.concurrency,
+		ExactCityMatch: conf.exactCity,
+		Locale:         conf.locale,
+	}
+	if conf.cityEquivalents != "" {
+		opts.CityEquivalents, err = readCityEquivalents(conf.cityEquivalents)
+		if err != nil {
+			return err
+		}
+	}
+	if conf.gazetteer != "" {
+		opts.Gazetteer, err = readGazetteer(conf.gazetteer)
+		if err != nil {
+			return err
+		}
+		opts.MinDistance = conf.minDistance
+	} else if conf.minDistance > 0 {
+		fmt.Fprintln(os.Stderr, "-min-distance is ignored without -gazetteer")
+	}
+	if opts.Concurrency == 0 {
+		opts.Concurrency = runtime.NumCPU()
+	}
+	if conf.progress {
+		opts.Progress = printProgress(os.Stderr)
+	}
+
+	if len(conf.db) > 1 {
+		return runMulti(ctx, conf, opts)
+	}
+
+	return runVerify(ctx, conf, opts)
+}
+
+// runVerify verifies the geofeed against at most one MMDB and writes the
+// report.
+func runVerify(ctx context.Context, conf *config, opts verify.Options) error {
+	rep := newReport(conf)
+	if conf.format == "sarif" || conf.format == "junit" {
+		rep.maxRows = maxReportedRows
+	}
+	// The structured formats report invalid and empty geofeeds themselves.
+	reported := func(err error) bool {
+		return conf.format != "text" &&
+			(errors.Is(err, verify.ErrInvalidGeofeed) || errors.Is(err, verify.ErrEmptyGeofeed))
+	}
+	var err error
+	writeErr := writeOutput(conf.output, func(w io.Writer) error {
+		// The text and csv outputs are written as the rows are verified, the
+		// other formats once the geofeed is verified.
+		rw := newRowWriter(w, conf.format)
+		onRow := rep.add
+		var rowErr error
+		if rw != nil {
+			onRow = func(r verify.RowResult) error {
+				rowErr = rw.writeRow(r)
+				return rowErr
 			}
 		}
+		err = rep.verify(ctx, conf, opts, onRow)
+		if conf.progress {
+			fmt.Fprintln(os.Stderr)
+		}
+		warnOldDatabases(os.Stderr, rep.databases(), conf.maxDBAge, time.Now())
+		switch {
+		case rowErr != nil:
+			return rowErr
+		case err != nil && !reported(err):
+			return nil
+		case rw != nil:
+			return rw.finish(rep)
+		default:
+			return writeReport(w, conf.format, rep)
+		}
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		if errors.Is(err, verify.ErrInvalidGeofeed) && !reported(err) {
+			logInvalidRows(rep.result)
+		}
 		return fmt.Errorf("unable to process geofeed %s: %w", conf.gf, err)
 	}
+	if conf.failOnDiff && rep.result.Differences > 0 {
+		return fmt.Errorf("%w: %d rows differ", errDifferences, rep.result.Differences)
+	}
+	return nil
+}
 
-	if conf.db == "" {
-		fmt.Printf(
-			"Validated %d rows. No MMDB provided (-db), so comparison was skipped.\n",
-			c.Total,
-		)
-		return nil
+// printProgress returns a progress callback that renders a single,
+// continuously updated status line to w.
+func printProgress(w io.Writer) func(verify.Progress) {
+	return func(p verify.Progress) {
+		percent := 100
+		if p.TotalBytes > 0 {
+			percent = int(p.Bytes * 100 / p.TotalBytes)
+		}
+		fmt.Fprintf(w, "\rProcessed %d rows (%d%%)", p.Rows, percent)
+	}
+}
+
+// warnOldDatabases prints a warning for each of the MMDBs that was built more
+// than maxAge before now. A maxAge of 0 disables the warnings.
+func warnOldDatabases(w io.Writer, dbs []database, maxAge time.Duration, now time.Time) {
+	if maxAge <= 0 {
+		return
+	}
+	for _, db := range dbs {
+		if age := db.Age(now); age > maxAge {
+			fmt.Fprintf(
+				w,
+				"Warning: the %s was built %d days ago (%s)\n",
+				db.Role,
+				int(age.Hours()/24),
+				db.BuildTime().Format(time.DateOnly),
+			)
+		}
 	}
+}
 
-	fmt.Printf(
-		strings.Join(diffLines, "\n\n")+
-			"\n\nOut of %d potential corrections, %d may be different than our current mappings\n\n",
+func logInvalidRows(c verify.CheckResult) {
+	log.Printf(
+		"Found %d invalid rows out of %d rows in total, examples by type:",
+		c.Invalid,
 		c.Total,
-		c.Differences,
 	)
+	for invType, invMessage := range c.SampleInvalidRows {
+		log.Printf("%s: '%s'", invType, invMessage)
+	}
+}
 
-	// https://stackoverflow.com/questions/18695346/how-can-i-sort-a-mapstringint-by-its-values/56706305#56706305
-	asNumbers := make([]uint, 0, len(asnCounts))
-	for asNumber := range asnCounts {
-		asNumbers = append(asNumbers, asNumber)
+// readCityEquivalents reads a CSV file of equivalent city names or words, one
+// pair per line, and returns them along with verify.DefaultCityEquivalents.
+// Comments starting with '#' are ignored.
+func readCityEquivalents(filename string) (map[string]string, error) {
+	f, err := os.Open(filepath.Clean(filename))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %w", filename, err)
 	}
-	slices.SortFunc(
-		asNumbers,
-		func(a, b uint) int {
-			return cmp.Compare(asnCounts[b], asnCounts[a])
-		},
-	)
-	for _, asNumber := range asNumbers {
-		fmt.Printf("ASN: %d, count: %d\n", asNumber, asnCounts[asNumber])
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, &inputFileError{err: fmt.Errorf("unable to read %s: %w", filename, err)}
+	}
+
+	equivalents := maps.Clone(verify.DefaultCityEquivalents)
+	for _, record := range records {
+		equivalents[strings.TrimSpace(record[0])] = strings.TrimSpace(record[1])
+	}
+	return equivalents, nil
+}
+
+// readGazetteer reads a CSV file of city coordinates in the format of
+// verify.ReadGazetteer.
+func readGazetteer(filename string) (*verify.Gazetteer, error) {
+	f, err := os.Open(filepath.Clean(filename))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %w", filename, err)
 	}
+	defer f.Close()
 
+	g, err := verify.ReadGazetteer(f)
+	if err != nil {
+		return nil, &inputFileError{err: fmt.Errorf("unable to read %s: %w", filename, err)}
+	}
+	return g, nil
+}
+
+// stringList is a flag that may be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
 	return nil
 }
 
@@ -112,12 +294,17 @@ func parseFlags(program string, args []string) (c *config, output string, err er
 
 	var conf config
 	flags.StringVar(&conf.gf, "gf", "", "Path to local geofeed file to verify")
-	flags.StringVar(&conf.isp, "isp", "", "Path to ISP MMDB file (optional)")
 	flags.StringVar(
+		&conf.isp,
+		"isp",
+		"",
+		"Path to ISP or ASN MMDB file, e.g., GeoIP2-ISP or GeoLite2-ASN (optional)",
+	)
+	flags.Var(
 		&conf.db,
 		"db",
-		"",
-		"Path to MMDB file to compare the geofeed against (optional; if omitted, only the geofeed format is validated)",
+		"Path to MMDB file to compare the geofeed against (optional; if omitted, only the geofeed format is validated). "+
+			"May be repeated to compare against several MMDBs, oldest first",
 	)
 	displayVersion := false
 	flags.BoolVar(&displayVersion, "V", false, "Display version")
@@ -131,6 +318,63 @@ func parseFlags(program string, args []string) (c *config, output string, err er
 		"empty-ok",
 		false,
 		"Allow empty geofeeds to be considered valid")
+	flags.BoolVar(
+		&conf.progress,
+		"progress",
+		false,
+		"Display progress on stderr while processing the geofeed")
+	flags.IntVar(
+		&conf.concurrency,
+		"concurrency",
+		0,
+		"Number of rows to verify concurrently (default: number of CPUs)")
+
+	flags.StringVar(
+		&conf.format,
+		"format",
+		"text",
+		"Output format: "+strings.Join(formats, ", "))
+	flags.StringVar(&conf.output, "o", "", "Path to write the output to (default: stdout)")
+	flags.BoolVar(
+		&conf.failOnDiff,
+		"fail-on-diff",
+		false,
+		"Exit with a non-zero status if the geofeed differs from the MMDB")
+	flags.BoolVar(
+		&conf.exactCity,
+		"exact-city",
+		false,
+		"Report city names that differ only in accents, punctuation or equivalent words "+
+			"as differences")
+	flags.StringVar(
+		&conf.cityEquivalents,
+		"city-equivalents",
+		"",
+		"Path to a CSV file of equivalent city names or words, e.g., 'St,Saint', "+
+			"used in addition to the defaults")
+	flags.StringVar(
+		&conf.locale,
+		"locale",
+		"en",
+		"Locale of the MMDB city names to display, e.g., 'de'. City names in all "+
+			"locales are compared")
+	flags.DurationVar(
+		&conf.maxDBAge,
+		"max-db-age",
+		0,
+		"Warn if an MMDB was built longer ago than this, e.g., 720h (default: no warning)")
+	flags.StringVar(
+		&conf.gazetteer,
+		"gazetteer",
+		"",
+		"Path to a CSV file of city coordinates (country, region, city, latitude, longitude) "+
+			"used to report the distance to the MMDB location")
+	flags.Float64Var(
+		&conf.minDistance,
+		"min-distance",
+		0,
+		"Do not report the city of rows closer than this many kilometers to the MMDB "+
+			"location as a difference, unless their country differs (requires -gazetteer)")
 
 	err = flags.Parse(args)
 	if err != nil {
@@ -148,5 +392,19 @@ func parseFlags(program string, args []string) (c *config, output string, err er
 		return nil, buf.String(), errors.New("-gf is required")
 	}
 
+	if !slices.Contains(formats, conf.format) {
+		flags.PrintDefaults()
+		return nil, buf.String(), fmt.Errorf("unknown format %q", conf.format)
+	}
+
+	if len(conf.db) > 1 && !slices.Contains(multiFormats, conf.format) {
+		flags.PrintDefaults()
+		return nil, buf.String(), fmt.Errorf(
+			"format %q does not support more than one -db; use one of: %s",
+			conf.format,
+			strings.Join(multiFormats, ", "),
+		)
+	}
+
 	return &conf, buf.String(), nil
 }
@@ -1,12 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
 )
 
 type parseFlagsCorrectTest struct {
@@ -19,48 +32,113 @@ func TestParseFlagsCorrect(t *testing.T) {
 		{
 			[]string{"-gf", "geofeed.csv"},
 			config{
-				gf: "geofeed.csv",
-				db: "",
+				format: "text",
+				locale: "en",
+				gf:     "geofeed.csv",
 			},
 		},
 		{
 			[]string{"-gf", "geofeed.csv", "-db", "file.mmdb"},
 			config{
-				gf: "geofeed.csv",
-				db: "file.mmdb",
+				format: "text",
+				locale: "en",
+				gf:     "geofeed.csv",
+				db:     stringList{"file.mmdb"},
 			},
 		},
 		{
 			[]string{"-db", "file.mmdb", "-gf", "geofeed.csv"},
 			config{
-				gf: "geofeed.csv",
-				db: "file.mmdb",
+				format: "text",
+				locale: "en",
+				gf:     "geofeed.csv",
+				db:     stringList{"file.mmdb"},
 			},
 		},
 		{
 			[]string{"--lax", "-db", "file.mmdb", "-gf", "geofeed.csv"},
 			config{
+				format:  "text",
+				locale:  "en",
 				gf:      "geofeed.csv",
-				db:      "file.mmdb",
+				db:      stringList{"file.mmdb"},
 				laxMode: true,
 			},
 		},
 		{
 			[]string{"-db", "file.mmdb", "-lax=true", "-gf", "geofeed.csv"},
 			config{
+				format:  "text",
+				locale:  "en",
 				gf:      "geofeed.csv",
-				db:      "file.mmdb",
+				db:      stringList{"file.mmdb"},
 				laxMode: true,
 			},
 		},
 		{
 			[]string{"-db", "file.mmdb", "-gf", "geofeed.csv", "--lax=false"},
 			config{
+				format:  "text",
+				locale:  "en",
 				gf:      "geofeed.csv",
-				db:      "file.mmdb",
+				db:      stringList{"file.mmdb"},
 				laxMode: false,
 			},
 		},
+		{
+			[]string{"-gf", "geofeed.csv", "-format", "sarif", "-o", "report.sarif"},
+			config{
+				gf:     "geofeed.csv",
+				format: "sarif",
+				output: "report.sarif",
+				locale: "en",
+			},
+		},
+		{
+			[]string{"-gf", "geofeed.csv", "-gazetteer", "cities.csv", "-min-distance", "25"},
+			config{
+				gf:          "geofeed.csv",
+				format:      "text",
+				locale:      "en",
+				gazetteer:   "cities.csv",
+				minDistance: 25,
+			},
+		},
+		{
+			[]string{"-gf", "geofeed.csv", "-db", "old.mmdb", "-db", "new.mmdb", "-format", "csv"},
+			config{
+				gf:     "geofeed.csv",
+				db:     stringList{"old.mmdb", "new.mmdb"},
+				format: "csv",
+				locale: "en",
+			},
+		},
+		{
+			[]string{"-gf", "geofeed.csv", "-locale", "de"},
+			config{
+				gf:     "geofeed.csv",
+				format: "text",
+				locale: "de",
+			},
+		},
+		{
+			[]string{"-gf", "geofeed.csv", "-max-db-age", "720h"},
+			config{
+				gf:       "geofeed.csv",
+				format:   "text",
+				locale:   "en",
+				maxDBAge: 30 * 24 * time.Hour,
+			},
+		},
+		{
+			[]string{"-gf", "geofeed.csv", "-progress"},
+			config{
+				format:   "text",
+				locale:   "en",
+				gf:       "geofeed.csv",
+				progress: true,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -104,6 +182,16 @@ func TestParseFlagsError(t *testing.T) {
 			"Path to local geofeed file",
 			"-gf is required",
 		},
+		{
+			[]string{"-gf", "geofeed.csv", "-format", "yaml"},
+			"Output format",
+			`unknown format "yaml"`,
+		},
+		{
+			[]string{"-gf", "geofeed.csv", "-db", "a.mmdb", "-db", "b.mmdb", "-format", "sarif"},
+			"Output format",
+			`format "sarif" does not support more than one -db; use one of: text, csv`,
+		},
 	}
 
 	for _, test := range tests {
@@ -126,3 +214,814 @@ func TestParseFlagsError(t *testing.T) {
 		)
 	}
 }
+
+func TestParseDiffFlags(t *testing.T) {
+	conf, output, err := parseDiffFlags(
+		"program",
+		[]string{"-old", "old.csv", "-new", "new.csv", "-format", "json"},
+	)
+	require.NoError(t, err)
+	assert.Empty(t, output)
+	assert.Equal(
+		t,
+		diffConfig{oldGF: "old.csv", newGF: "new.csv", format: "json"},
+		*conf,
+	)
+
+	_, _, err = parseDiffFlags("program", []string{"-old", "old.csv"})
+	require.EqualError(t, err, "-old and -new are required")
+
+	_, _, err = parseDiffFlags(
+		"program",
+		[]string{"-old", "old.csv", "-new", "new.csv", "-format", "xml"},
+	)
+	require.EqualError(t, err, `unknown format "xml"`)
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := parsePrefixes(
+		strings.NewReader(
+			"# allocations\n81.2.69.128/25,some note\n202.196.224.5\n\n2001:db8::1 # host\n",
+		),
+		"prefixes.txt",
+	)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]netip.Prefix{
+			netip.MustParsePrefix("81.2.69.128/25"),
+			netip.MustParsePrefix("202.196.224.5/32"),
+			netip.MustParsePrefix("2001:db8::1/128"),
+		},
+		prefixes,
+	)
+
+	_, err = parsePrefixes(strings.NewReader("10.0.0.0/33\n"), "prefixes.txt")
+	require.ErrorContains(t, err, "prefixes.txt line 1: invalid prefix")
+}
+
+func TestParseCompileFlags(t *testing.T) {
+	conf, _, err := parseCompileFlags(
+		"program",
+		[]string{"-gf", "geofeed.csv", "-db", "base.mmdb", "-o", "out.mmdb"},
+	)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		compileConfig{gf: "geofeed.csv", db: "base.mmdb", output: "out.mmdb"},
+		*conf,
+	)
+
+	_, _, err = parseCompileFlags("program", []string{"-gf", "geofeed.csv"})
+	require.EqualError(t, err, "-gf and -o are required")
+}
+
+func TestCompileGeofeed(t *testing.T) {
+	dir := t.TempDir()
+	b, err := os.ReadFile("verify/test_data/GeoIP2-City-Test.mmdb")
+	require.NoError(t, err)
+	mmdb := filepath.Join(dir, "GeoIP2-City.mmdb")
+	require.NoError(t, os.WriteFile(mmdb, b, 0o600))
+
+	// The base MMDB may be overwritten.
+	c, err := compileGeofeed(&compileConfig{
+		gf:     "verify/test_data/geofeed-valid.csv",
+		db:     mmdb,
+		output: mmdb,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, c.Total)
+
+	rep, err := verifyGeofeed(
+		t.Context(),
+		&config{gf: "verify/test_data/geofeed-valid.csv", db: stringList{mmdb}},
+		verify.Options{},
+	)
+	require.NoError(t, err)
+	assert.Zero(t, rep.result.Differences)
+
+	// A failed compilation leaves the output alone and no temporary file.
+	_, err = compileGeofeed(&compileConfig{
+		gf:     "verify/test_data/geofeed-invalid-network.csv",
+		output: mmdb,
+	})
+	require.ErrorIs(t, err, verify.ErrInvalidGeofeed)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "GeoIP2-City.mmdb", entries[0].Name())
+}
+
+func TestParseAdoptionFlags(t *testing.T) {
+	conf, _, err := parseAdoptionFlags(
+		"program",
+		[]string{"-gf", "geofeed.csv", "-dir", "mmdbs", "-format", "csv"},
+	)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		adoptionConfig{gf: "geofeed.csv", dir: "mmdbs", format: "csv"},
+		*conf,
+	)
+
+	_, _, err = parseAdoptionFlags("program", []string{"-gf", "geofeed.csv"})
+	require.EqualError(t, err, "-gf and -dir are required")
+}
+
+func TestWriteAdoption(t *testing.T) {
+	dir := t.TempDir()
+	b, err := os.ReadFile("verify/test_data/GeoIP2-City-Test.mmdb")
+	require.NoError(t, err)
+	mmdb := filepath.Join(dir, "GeoIP2-City.mmdb")
+	require.NoError(t, os.WriteFile(mmdb, b, 0o600))
+
+	rep := &adoptionReport{}
+	rep.result, err = verify.TrackAdoption(
+		t.Context(),
+		"verify/test_data/geofeed-valid.csv",
+		dir,
+		verify.Options{},
+		func(r verify.AdoptionRowResult) error {
+			rep.rows = append(rep.rows, r)
+			return nil
+		},
+	)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	writeAdoptionText(&buf, rep)
+	out := buf.String()
+	for _, s := range []string{
+		"first matched in " + mmdb + " (built 2020-09-23)\n",
+		"\nNot adopted in " + mmdb + " (built 2020-09-23):\n" +
+			"Line 1: '2a02:ecc0::/29', suggested: 'US,US-NJ,Parsippany,', current: 'AZ,,,'\n",
+		"Out of 3 potential corrections, 2 have not been adopted as of the latest of 1 MMDBs",
+	} {
+		assert.Contains(t, out, s)
+	}
+
+	buf.Reset()
+	require.NoError(t, writeAdoptionCSV(&buf, rep))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, adoptionCSVHeader, records[0])
+	assert.Equal(t, []string{"false", "", ""}, records[1][2:5])
+	assert.Equal(t, []string{"true", mmdb, "2020-09-23T18:39:12Z"}, records[3][2:5])
+}
+
+func TestPrintProgress(t *testing.T) {
+	var buf bytes.Buffer
+	progress := printProgress(&buf)
+	progress(verify.Progress{Rows: 1000, Bytes: 250, TotalBytes: 1000})
+	progress(verify.Progress{Rows: 4000, Bytes: 1000, TotalBytes: 1000})
+	assert.Equal(t, "\rProcessed 1000 rows (25%)\rProcessed 4000 rows (100%)", buf.String())
+}
+
+func TestWriteSARIF(t *testing.T) {
+	rep, err := verifyGeofeed(
+		t.Context(),
+		&config{
+			gf: "verify/test_data/geofeed-invalid-comments.csv",
+			db: stringList{"verify/test_data/GeoIP2-City-Test.mmdb"},
+		},
+		verify.Options{},
+	)
+	require.ErrorIs(t, err, verify.ErrInvalidGeofeed)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeSARIF(&buf, rep))
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	assert.Len(t, log.Runs[0].Tool.Driver.Rules, len(rules))
+
+	type result struct {
+		ruleID string
+		level  string
+		region sarifRegion
+	}
+	var results []result
+	for _, r := range log.Runs[0].Results {
+		require.Len(t, r.Locations, 1)
+		loc := r.Locations[0].PhysicalLocation
+		assert.Equal(
+			t,
+			sarifArtifactLocation{
+				URI:       "verify/test_data/geofeed-invalid-comments.csv",
+				URIBaseID: "%SRCROOT%",
+			},
+			loc.ArtifactLocation,
+		)
+		assert.Equal(t, r.RuleID, log.Runs[0].Tool.Driver.Rules[r.RuleIndex].ID)
+		results = append(results, result{r.RuleID, r.Level, *loc.Region})
+	}
+	assert.Equal(
+		t,
+		[]result{
+			{"LocationDifference", "warning", sarifRegion{StartLine: 3}},
+			{"InvalidRegionCode", "error", sarifRegion{StartLine: 6}},
+			{"FewerFieldsThanExpected", "error", sarifRegion{StartLine: 8}},
+			{"UnableToParseNetwork", "error", sarifRegion{StartLine: 9}},
+		},
+		results,
+	)
+
+	require.NotNil(t, log.Runs[0].Properties)
+	require.Len(t, log.Runs[0].Properties.Databases, 1)
+	db := log.Runs[0].Properties.Databases[0]
+	assert.Equal(t, "MMDB", db.Role)
+	assert.Equal(t, "GeoIP2-City", db.DatabaseType)
+	assert.Equal(t, uint(1600886352), db.BuildEpoch)
+	assert.Contains(t, buf.String(), `"languages": [`)
+}
+
+func TestSARIFArtifact(t *testing.T) {
+	repo := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(repo, ".git"), 0o750))
+	require.NoError(t, os.Mkdir(filepath.Join(repo, "feeds"), 0o750))
+	outside := filepath.Join(t.TempDir(), "geofeed.csv")
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc     string
+		geofeed  string
+		expected sarifArtifactLocation
+	}{
+		{
+			"relative path",
+			"verify/test_data/geofeed-valid.csv",
+			sarifArtifactLocation{URI: "verify/test_data/geofeed-valid.csv", URIBaseID: "%SRCROOT%"},
+		},
+		{
+			"absolute path",
+			filepath.Join(wd, "verify", "test_data", "geofeed-valid.csv"),
+			sarifArtifactLocation{URI: "verify/test_data/geofeed-valid.csv", URIBaseID: "%SRCROOT%"},
+		},
+		{
+			"other repository",
+			filepath.Join(repo, "feeds", "geofeed.csv"),
+			sarifArtifactLocation{URI: "feeds/geofeed.csv", URIBaseID: "%SRCROOT%"},
+		},
+		{
+			"outside a repository",
+			outside,
+			sarifArtifactLocation{URI: "file://" + filepath.ToSlash(outside)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert.Equal(t, test.expected, sarifArtifact(test.geofeed))
+		})
+	}
+}
+
+func TestWriteSARIF_Empty(t *testing.T) {
+	rep, err := verifyGeofeed(
+		t.Context(),
+		&config{gf: "verify/test_data/empty.csv"},
+		verify.Options{},
+	)
+	require.ErrorIs(t, err, verify.ErrEmptyGeofeed)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeSARIF(&buf, rep))
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	require.Len(t, log.Runs[0].Results, 1)
+	assert.Equal(t, emptyGeofeedRule, log.Runs[0].Results[0].RuleID)
+	assert.Nil(t, log.Runs[0].Results[0].Locations[0].PhysicalLocation.Region)
+	assert.Nil(t, log.Runs[0].Properties)
+}
+
+func TestWriteJUnit(t *testing.T) {
+	rep, err := verifyGeofeed(
+		t.Context(),
+		&config{
+			gf: "verify/test_data/geofeed-invalid-comments.csv",
+			db: stringList{"verify/test_data/GeoIP2-City-Test.mmdb"},
+		},
+		verify.Options{},
+	)
+	require.ErrorIs(t, err, verify.ErrInvalidGeofeed)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeJUnit(&buf, rep))
+
+	var suites junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &suites))
+	assert.Equal(t, len(rules), suites.Tests)
+	assert.Equal(t, 3, suites.Failures)
+	assert.Equal(t, 1, suites.Skipped)
+	require.Len(t, suites.Suites, 1)
+	assert.Equal(
+		t,
+		[]junitProperty{{
+			Name:  "MMDB",
+			Value: "GeoIP2-City built 2020-09-23 18:39:12 UTC, IPv6, languages: en, zh",
+		}},
+		suites.Suites[0].Properties,
+	)
+
+	failures := map[string]bool{}
+	skipped := map[string]bool{}
+	for _, tc := range suites.Suites[0].TestCases {
+		if tc.Failure != nil {
+			failures[tc.Name] = true
+		}
+		if tc.Skipped != nil {
+			skipped[tc.Name] = true
+		}
+	}
+	assert.Equal(
+		t,
+		map[string]bool{
+			"FewerFieldsThanExpected": true,
+			"UnableToParseNetwork":    true,
+			"InvalidRegionCode":       true,
+		},
+		failures,
+	)
+	assert.Equal(t, map[string]bool{"UnableToFindISPRecord": true}, skipped)
+	assert.Contains(
+		t,
+		buf.String(),
+		"line 6, column 22: invalid ISO 3166-2 region code format",
+	)
+	assert.Contains(t, buf.String(), "line 3: Found a potential improvement: '2a02:ecc0::/29'")
+}
+
+func TestReport_MaxRows(t *testing.T) {
+	conf := &config{
+		gf: "verify/test_data/geofeed-invalid-comments.csv",
+		db: stringList{"verify/test_data/GeoIP2-City-Test.mmdb"},
+	}
+	rep := newReport(conf)
+	rep.maxRows = 1
+	err := rep.verify(t.Context(), conf, verify.Options{}, rep.add)
+	require.ErrorIs(t, err, verify.ErrInvalidGeofeed)
+	require.Len(t, rep.rows, 1)
+	assert.Equal(t, 3, rep.omitted)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeJUnit(&buf, rep))
+	var suites junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &suites))
+	assert.Equal(t, 3, suites.Failures)
+	for _, tc := range suites.Suites[0].TestCases {
+		if tc.Failure != nil {
+			assert.Contains(t, tc.Failure.Message, "(rows: 1)")
+			assert.Equal(t, "1 more rows not listed", tc.Failure.Text)
+		}
+	}
+
+	buf.Reset()
+	require.NoError(t, writeSARIF(&buf, rep))
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	assert.Len(t, log.Runs[0].Results, 1)
+	require.NotNil(t, log.Runs[0].Properties)
+	assert.Equal(t, 3, log.Runs[0].Properties.OmittedResults)
+}
+
+func TestRunVerify(t *testing.T) {
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			conf := &config{
+				gf:     "verify/test_data/geofeed-valid.csv",
+				db:     stringList{"verify/test_data/GeoIP2-City-Test.mmdb"},
+				format: format,
+				output: filepath.Join(t.TempDir(), "output"),
+			}
+			require.NoError(t, runVerify(t.Context(), conf, verify.Options{}))
+			out, err := os.ReadFile(conf.output)
+			require.NoError(t, err)
+
+			// The output is the same whether or not it is written as the
+			// rows are verified.
+			rep, err := verifyGeofeed(t.Context(), conf, verify.Options{})
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			require.NoError(t, writeReport(&buf, format, rep))
+			assert.Equal(t, buf.String(), string(out))
+		})
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	rep, err := verifyGeofeed(
+		t.Context(),
+		&config{
+			gf: "verify/test_data/geofeed-invalid-comments.csv",
+			db: stringList{"verify/test_data/GeoIP2-City-Test.mmdb"},
+		},
+		verify.Options{},
+	)
+	require.ErrorIs(t, err, verify.ErrInvalidGeofeed)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeHTML(&buf, rep))
+
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "<!DOCTYPE html>"))
+	for _, s := range []string{
+		`<div class="counter"><div class="value">4</div>rows</div>`,
+		`<div class="counter"><div class="value">1</div>differences</div>`,
+		`<div class="counter"><div class="value">3</div>invalid rows</div>`,
+		`<tr><td>city</td><td class="num">1</td></tr>`,
+		`<td class="diff"><del></del> <ins>US-NJ</ins></td>`,
+		`<td>InvalidRegionCode</td><td>9</td>`,
+		`<tr><td>MMDB</td><td>GeoIP2-City</td><td>2020-09-23 18:39:12 UTC</td>`,
+		// Values from the geofeed are escaped.
+		`row: &#39;202.196.224.5/32,AT&#39;`,
+	} {
+		assert.Contains(t, out, s)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	rep, err := verifyGeofeed(
+		t.Context(),
+		&config{
+			gf: "verify/test_data/geofeed-valid.csv",
+			db: stringList{"verify/test_data/GeoIP2-City-Test.mmdb"},
+		},
+		verify.Options{},
+	)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeText(&buf, rep))
+	assert.Contains(
+		t,
+		buf.String(),
+		"Out of 3 potential corrections, 2 may be different than our current mappings\n\n"+
+			"Differences by field: country: 2, region: 2, city: 2 (city only: 0), "+
+			"postal code: 1\n\n",
+	)
+}
+
+func TestWriteText_PercentSigns(t *testing.T) {
+	gf := filepath.Join(t.TempDir(), "geofeed.csv")
+	require.NoError(t, os.WriteFile(gf, []byte("202.196.224.5/32,AT,AT-9,Lon%don%d,\n"), 0o600))
+	rep, err := verifyGeofeed(
+		t.Context(),
+		&config{gf: gf, db: stringList{"verify/test_data/GeoIP2-City-Test.mmdb"}},
+		verify.Options{},
+	)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeText(&buf, rep))
+	out := buf.String()
+	assert.Contains(t, out, "'Lon%don%d'")
+	assert.Contains(
+		t,
+		out,
+		"Out of 1 potential corrections, 1 may be different than our current mappings",
+	)
+	assert.NotContains(t, out, "%!")
+}
+
+func TestWriteCSV(t *testing.T) {
+	rep, err := verifyGeofeed(
+		t.Context(),
+		&config{
+			gf: "verify/test_data/geofeed-valid.csv",
+			db: stringList{"verify/test_data/GeoIP2-City-Test.mmdb"},
+		},
+		verify.Options{},
+	)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeCSV(&buf, rep))
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 1+rep.result.Differences)
+	assert.Equal(t, csvHeader, records[0])
+	for _, record := range records[1:] {
+		assert.Len(t, record, len(csvHeader))
+	}
+	assert.Equal(
+		t,
+		[]string{
+			"202.196.224.5/32", "2", "country;region;city;postal code",
+			"PH", "AT", "", "AT-9", "mismatch", "", "", "Vienna", "mismatch", "",
+			"34021", "1060", "", "",
+			"", "", "",
+		},
+		records[2],
+	)
+}
+
+func TestWriteCSV_CountryDatabase(t *testing.T) {
+	rep := &report{compared: true}
+	rep.rows = append(rep.rows, verify.RowResult{
+		Line: 1,
+		Diff: "differs",
+		Comparison: &verify.Comparison{
+			Network:     "192.0.2.0/24",
+			Suggested:   verify.Location{Country: "US", Region: "US-WA", City: "Seattle"},
+			Current:     verify.Location{Country: "CA"},
+			Fields:      []verify.Field{verify.CountryField},
+			Differences: []verify.Field{verify.CountryField},
+		},
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, writeCSV(&buf, rep))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "country", records[1][2])
+	assert.Empty(t, records[1][7], "region_match")
+	assert.Empty(t, records[1][11], "city_match")
+}
+
+func TestWriteCSV_Formulas(t *testing.T) {
+	rep := &report{compared: true}
+	rep.rows = append(rep.rows, verify.RowResult{
+		Line: 1,
+		Diff: "differs",
+		Comparison: &verify.Comparison{
+			Network:        "192.0.2.0/24",
+			Suggested:      verify.Location{Country: "US", City: "=HYPERLINK(\"x\")"},
+			Current:        verify.Location{Country: "US", City: "Seattle"},
+			Differences:    []verify.Field{verify.CityField},
+			ASNumber:       64496,
+			ASOrganization: "@SUM(1+1)",
+			ISP:            "-1+1",
+		},
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, writeCSV(&buf, rep))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "'=HYPERLINK(\"x\")", records[1][10])
+	assert.Equal(t, "'@SUM(1+1)", records[1][18])
+	assert.Equal(t, "'-1+1", records[1][19])
+	assert.Equal(t, "Seattle", records[1][9])
+}
+
+func TestWriteMulti(t *testing.T) {
+	// The geofeed compiled over the test MMDB matches every row.
+	compiled := filepath.Join(t.TempDir(), "compiled.mmdb")
+	f, err := os.Create(compiled)
+	require.NoError(t, err)
+	_, err = verify.CompileGeofeed(
+		"verify/test_data/geofeed-valid.csv",
+		"verify/test_data/GeoIP2-City-Test.mmdb",
+		f,
+		verify.Options{},
+	)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	conf := &config{
+		gf: "verify/test_data/geofeed-valid.csv",
+		db: stringList{"verify/test_data/GeoIP2-City-Test.mmdb", compiled},
+	}
+	rep, err := compareGeofeed(t.Context(), conf, verify.Options{})
+	require.NoError(t, err)
+	require.Len(t, rep.rows, 2)
+
+	var buf bytes.Buffer
+	writeMultiText(&buf, rep)
+	out := buf.String()
+	for _, s := range []string{
+		"Line 2: '202.196.224.5/32', suggested: 'AT,AT-9,Vienna,1060'",
+		"\t\tverify/test_data/GeoIP2-City-Test.mmdb: differs in country, region, city, postal code",
+		"\t\t" + conf.db[1] + ": matches",
+		"Out of 3 potential corrections:",
+		"verify/test_data/GeoIP2-City-Test.mmdb (GeoIP2-City built 2020-09-23 18:39:12 UTC, " +
+			"IPv6, languages: en, zh): 2 may be different than our current mappings\n",
+		": 0 may be different than our current mappings, 2 picked up and 0 no longer " +
+			"matching since verify/test_data/GeoIP2-City-Test.mmdb",
+	} {
+		assert.Contains(t, out, s)
+	}
+
+	buf.Reset()
+	require.NoError(t, writeMultiCSV(&buf, rep))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 1+2*len(rep.rows))
+	assert.Equal(t, multiCSVHeader, records[0])
+	assert.Equal(
+		t,
+		[]string{
+			"202.196.224.5/32", "2", "verify/test_data/GeoIP2-City-Test.mmdb",
+			"2020-09-23T18:39:12Z", "country;region;city;postal code",
+			"PH", "AT", "", "AT-9", "", "Vienna", "34021", "1060",
+		},
+		records[3],
+	)
+	assert.Equal(t, conf.db[1], records[4][2])
+	assert.Empty(t, records[4][4])
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	rep := &report{
+		geofeed:  "geofeed.csv",
+		compared: true,
+		result:   verify.CheckResult{Total: 40, Differences: 30, Invalid: 1},
+	}
+	rep.rows = append(rep.rows, verify.RowResult{
+		Line: 1,
+		Err: &verify.RowError{
+			Line:       1,
+			Invalidity: verify.FewerFieldsThanExpected,
+			Reason:     "expected 5 fields but got 2, row: 'a|b,c'",
+		},
+	})
+	for i := range 30 {
+		rep.rows = append(rep.rows, verify.RowResult{
+			Line: i + 2,
+			Diff: "differs",
+			Comparison: &verify.Comparison{
+				Network:     "192.0.2.0/24",
+				Suggested:   verify.Location{Country: "US", City: "Milton"},
+				Current:     verify.Location{Country: "US", City: "Seattle"},
+				Differences: []verify.Field{verify.CityField},
+				ASNumber:    uint(64496 + i%12),
+			},
+		})
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeMarkdown(&buf, rep))
+
+	out := buf.String()
+	for _, s := range []string{
+		"| 40 | 30 | 1 |",
+		"| FewerFieldsThanExpected | 1 | line 1: expected 5 fields but got 2, row: 'a\\|b,c' |",
+		"| 2 | `192.0.2.0/24` | `US` | _empty_ | `Seattle` → `Milton` | _empty_ |",
+		"_2 more ASNs not shown._",
+		"_5 more differences not shown._",
+	} {
+		assert.Contains(t, out, s)
+	}
+	assert.Equal(t, markdownMaxDifferences, strings.Count(out, "`192.0.2.0/24`"))
+}
+
+func TestMarkdownCell(t *testing.T) {
+	tests := []struct {
+		value string
+		cell  string
+		code  string
+	}{
+		{"Seattle", "Seattle", "`Seattle`"},
+		{"a|b", `a\|b`, "`a\\|b`"},
+		{"**bold** _it_", `\*\*bold\*\* \_it\_`, "`**bold** _it_`"},
+		{"[x](https://example.com)", `\[x\](https://example.com)`, "`[x](https://example.com)`"},
+		{"<img src=x>", `\<img src=x\>`, "`<img src=x>`"},
+		{"`code` \\", "\\`code\\` \\\\", "`'code' \\`"},
+		{"two\nlines", "two lines", "`two lines`"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			assert.Equal(t, test.cell, markdownCell(test.value))
+			assert.Equal(t, test.code, markdownCode(test.value))
+		})
+	}
+}
+
+func TestWriteMarkdown_Heading(t *testing.T) {
+	rep := &report{geofeed: "feeds/`geo` feed.csv"}
+	var buf bytes.Buffer
+	require.NoError(t, writeMarkdown(&buf, rep))
+	assert.True(
+		t,
+		strings.HasPrefix(buf.String(), "## Geofeed verification: `feeds/'geo' feed.csv`\n"),
+		buf.String(),
+	)
+}
+
+func TestExitCode(t *testing.T) {
+	_, _, parseErr := parseFlags("program", []string{"-gf", "geofeed.csv", "-format", "yaml"})
+	_, _, helpErr := parseFlags("program", []string{"-h"})
+
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"success", nil, exitOK},
+		{"help", &usageError{err: helpErr}, exitOK},
+		{"usage", &usageError{err: parseErr}, exitUsage},
+		{"unknown", errors.New("unknown"), exitFailure},
+		{
+			"interrupted",
+			fmt.Errorf("unable to process geofeed: %w", context.Canceled),
+			exitInterrupted,
+		},
+		{"encoding", fmt.Errorf("unable to process geofeed: %w", verify.ErrNotUTF8), exitEncoding},
+		{"empty", fmt.Errorf("unable to process geofeed: %w", verify.ErrEmptyGeofeed), exitEmpty},
+		{"differences", fmt.Errorf("%w: 2 rows differ", errDifferences), exitDifferences},
+		{
+			"no MMDB",
+			fmt.Errorf("unable to track the adoption of geofeed: %w", verify.ErrNoMMDB),
+			exitUsage,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.code, exitCode(test.err))
+		})
+	}
+
+	for _, test := range []struct {
+		gf   string
+		db   string
+		code int
+	}{
+		{"verify/test_data/does-not-exist.csv", "", exitIO},
+		{"verify/test_data/geofeed-valid.csv", "verify/test_data/does-not-exist.mmdb", exitIO},
+		{"verify/test_data/geofeed-valid.csv", "verify/test_data/geofeed-valid.csv", exitIO},
+		{"verify/test_data/geofeed-valid-utf16le.csv", "", exitEncoding},
+		{"verify/test_data/geofeed-invalid-network.csv", "", exitInvalid},
+		{"verify/test_data/empty.csv", "", exitEmpty},
+	} {
+		t.Run(test.gf+" "+test.db, func(t *testing.T) {
+			conf := &config{gf: test.gf}
+			if test.db != "" {
+				conf.db = stringList{test.db}
+			}
+			_, err := verifyGeofeed(t.Context(), conf, verify.Options{})
+			assert.Equal(t, test.code, exitCode(err))
+		})
+	}
+
+	// Malformed input files other than the geofeed are I/O errors.
+	dir := t.TempDir()
+	malformed := filepath.Join(dir, "malformed.csv")
+	require.NoError(t, os.WriteFile(malformed, []byte("a,\"b\n"), 0o600))
+	_, err := readCityEquivalents(malformed)
+	assert.Equal(t, exitIO, exitCode(err))
+	_, err = readGazetteer(malformed)
+	assert.Equal(t, exitIO, exitCode(err))
+	_, err = verifyGeofeed(t.Context(), &config{gf: malformed}, verify.Options{})
+	assert.Equal(t, exitInvalid, exitCode(err))
+}
+
+func TestReadCityEquivalents(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cities.csv")
+	err := os.WriteFile(
+		filename,
+		[]byte("# name,equivalent\nFrankfurt am Main, Frankfurt\nSt,Sankt\n"),
+		0o600,
+	)
+	require.NoError(t, err)
+
+	equivalents, err := readCityEquivalents(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "Frankfurt", equivalents["Frankfurt am Main"])
+	assert.Equal(t, "Sankt", equivalents["St"])
+	assert.Equal(t, "Mount", equivalents["Mt"])
+	assert.Equal(t, "Saint", verify.DefaultCityEquivalents["St"])
+
+	err = os.WriteFile(filename, []byte("Frankfurt am Main\n"), 0o600)
+	require.NoError(t, err)
+	_, err = readCityEquivalents(filename)
+	require.Error(t, err)
+}
+
+func TestWarnOldDatabases(t *testing.T) {
+	dbs := []database{
+		{
+			Role:         "MMDB",
+			DatabaseInfo: &verify.DatabaseInfo{DatabaseType: "GeoIP2-City", BuildEpoch: 1600886352},
+		},
+		{
+			Role:         "ISP MMDB",
+			DatabaseInfo: &verify.DatabaseInfo{DatabaseType: "GeoIP2-ISP", BuildEpoch: 1602700752},
+		},
+	}
+	now := time.Date(2020, 10, 23, 18, 39, 12, 0, time.UTC)
+
+	var buf bytes.Buffer
+	warnOldDatabases(&buf, dbs, 10*24*time.Hour, now)
+	assert.Equal(t, "Warning: the MMDB was built 30 days ago (2020-09-23)\n", buf.String())
+
+	buf.Reset()
+	warnOldDatabases(&buf, dbs, 5*24*time.Hour, now)
+	assert.Equal(
+		t,
+		"Warning: the MMDB was built 30 days ago (2020-09-23)\n"+
+			"Warning: the ISP MMDB was built 9 days ago (2020-10-14)\n",
+		buf.String(),
+	)
+
+	buf.Reset()
+	warnOldDatabases(&buf, dbs, 0, now)
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
+)
+
+// The markdown output is meant for pull request comments, so the lists in it
+// are truncated to these sizes.
+const (
+	markdownMaxInvalidityTypes = 10
+	markdownMaxASNs            = 10
+	markdownMaxDifferences     = 25
+)
+
+// writeMarkdown writes a concise summary of the report in GitHub-flavored
+// Markdown.
+func writeMarkdown(w io.Writer, rep *report) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "## Geofeed verification: %s\n\n", markdownCodeSpan(rep.geofeed))
+	if rep.compared {
+		fmt.Fprintf(bw, "| Rows | Differences | Invalid rows |\n|---:|---:|---:|\n")
+		fmt.Fprintf(
+			bw,
+			"| %d | %d | %d |\n",
+			rep.result.Total,
+			rep.result.Differences,
+			rep.result.Invalid,
+		)
+	} else {
+		fmt.Fprintf(bw, "| Rows | Invalid rows |\n|---:|---:|\n")
+		fmt.Fprintf(bw, "| %d | %d |\n", rep.result.Total, rep.result.Invalid)
+	}
+	if rep.empty {
+		fmt.Fprintf(bw, "\n**The geofeed is empty.**\n")
+	}
+	if dbs := rep.databases(); len(dbs) > 0 {
+		fmt.Fprintln(bw)
+		for _, db := range dbs {
+			fmt.Fprintf(bw, "- %s: %s\n", db.Role, markdownCell(db.DatabaseInfo.String()))
+		}
+	}
+
+	writeMarkdownInvalidRows(bw, rep)
+	writeMarkdownASNs(bw, rep)
+	writeMarkdownDifferences(bw, rep)
+
+	return bw.Flush()
+}
+
+func writeMarkdownInvalidRows(w io.Writer, rep *report) {
+	var (
+		counts   = map[verify.RowInvalidity]int{}
+		examples = map[verify.RowInvalidity]*verify.RowError{}
+	)
+	for _, r := range rep.rows {
+		if r.Err == nil {
+			continue
+		}
+		if counts[r.Err.Invalidity] == 0 {
+			examples[r.Err.Invalidity] = r.Err
+		}
+		counts[r.Err.Invalidity]++
+	}
+	if len(counts) == 0 {
+		return
+	}
+
+	types := make([]verify.RowInvalidity, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	slices.SortFunc(types, func(a, b verify.RowInvalidity) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+
+	fmt.Fprintf(w, "\n### Invalid rows\n\n| Type | Rows | Example |\n|---|---:|---|\n")
+	for _, t := range types[:min(len(types), markdownMaxInvalidityTypes)] {
+		fmt.Fprintf(
+			w,
+			"| %s | %d | %s |\n",
+			t,
+			counts[t],
+			markdownCell(examples[t].Error()),
+		)
+	}
+}
+
+func writeMarkdownASNs(w io.Writer, rep *report) {
+	asns := rep.differencesByASN()
+	if len(asns) == 0 {
+		return
+	}
+
+	fmt.Fprintf(
+		w,
+		"\n### Top differing ASNs\n\n| ASN | AS organization | Differences |\n|---:|---|---:|\n",
+	)
+	for _, c := range asns[:min(len(asns), markdownMaxASNs)] {
+		fmt.Fprintf(
+			w,
+			"| %d | %s | %d |\n",
+			c.asNumber,
+			markdownCell(c.asOrganization),
+			c.n,
+		)
+	}
+	if len(asns) > markdownMaxASNs {
+		fmt.Fprintf(w, "\n_%d more ASNs not shown._\n", len(asns)-markdownMaxASNs)
+	}
+}
+
+func writeMarkdownDifferences(w io.Writer, rep *report) {
+	differences := 0
+	for _, r := range rep.rows {
+		if r.Diff != "" && r.Comparison != nil {
+			differences++
+		}
+	}
+	if differences == 0 {
+		return
+	}
+
+	fmt.Fprintf(
+		w,
+		"\n### Differences\n\n| Line | Network | Country | Region | City | Postal code |\n"+
+			"|---:|---|---|---|---|---|\n",
+	)
+	shown := 0
+	for _, r := range rep.rows {
+		if r.Diff == "" || r.Comparison == nil {
+			continue
+		}
+		if shown == markdownMaxDifferences {
+			break
+		}
+		shown++
+
+		cells := []string{fmt.Sprint(r.Line), markdownCode(r.Comparison.Network)}
+		for _, f := range locationFields {
+			cell := markdownCode(r.Comparison.Suggested.Value(f))
+			if slices.Contains(r.Comparison.Differences, f) {
+				cell = markdownCode(r.Comparison.Current.Value(f)) + " → " + cell
+			}
+			cells = append(cells, cell)
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+	}
+	if differences > shown {
+		fmt.Fprintf(w, "\n_%d more differences not shown._\n", differences-shown)
+	}
+}
+
+// markdownEscaper escapes the characters that have a meaning in Markdown, so
+// that values from the geofeed and the MMDBs cannot add formatting, links or
+// HTML to the output.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"~", `\~`,
+	"[", `\[`,
+	"]", `\]`,
+	"<", `\<`,
+	">", `\>`,
+	"&", `\&`,
+	"|", `\|`,
+)
+
+// markdownCell returns s escaped for use in a Markdown table cell.
+func markdownCell(s string) string {
+	return markdownEscaper.Replace(markdownLine(s))
+}
+
+// markdownCode returns s as inline code for use in a Markdown table cell.
+// Empty values are shown as such.
+func markdownCode(s string) string {
+	if s == "" {
+		return "_empty_"
+	}
+	// Backslash escapes do not apply in code spans, but tables still need
+	// pipes to be escaped.
+	return markdownCodeSpan(strings.ReplaceAll(s, "|", `\|`))
+}
+
+// markdownCodeSpan returns s as inline code. Backticks, which would end the
+// code span, are replaced with single quotes.
+func markdownCodeSpan(s string) string {
+	return "`" + strings.ReplaceAll(markdownLine(s), "`", "'") + "`"
+}
+
+// markdownLine returns s on a single line, with runs of white space replaced
+// with a single space.
+func markdownLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
+)
+
+// multiFormats are the output formats supported when comparing a geofeed
+// against several MMDBs.
+var multiFormats = []string{"text", "csv"}
+
+// multiReport holds the results of comparing a geofeed against several
+// MMDBs.
+type multiReport struct {
+	// mmdbs holds the paths to the MMDBs, in the order they were compared.
+	mmdbs  []string
+	result verify.MultiCheckResult
+	// rows holds the rows that are invalid or differ from any of the MMDBs,
+	// in geofeed order.
+	rows []verify.MultiRowResult
+}
+
+// runMulti compares the geofeed against each of the MMDBs in conf.db and
+// writes the report.
+func runMulti(ctx context.Context, conf *config, opts verify.Options) error {
+	rep, err := compareGeofeed(ctx, conf, opts)
+	if conf.progress {
+		fmt.Fprintln(os.Stderr)
+	}
+	warnOldDatabases(os.Stderr, rep.databases(), conf.maxDBAge, time.Now())
+	reported := conf.format != "text" &&
+		(errors.Is(err, verify.ErrInvalidGeofeed) || errors.Is(err, verify.ErrEmptyGeofeed))
+	if err != nil && !reported {
+		if errors.Is(err, verify.ErrInvalidGeofeed) {
+			logInvalidRows(verify.CheckResult{
+				Total:             rep.result.Total,
+				Invalid:           rep.result.Invalid,
+				SampleInvalidRows: rep.result.SampleInvalidRows,
+			})
+		}
+		return fmt.Errorf("unable to process geofeed %s: %w", conf.gf, err)
+	}
+
+	writeErr := writeOutput(conf.output, func(w io.Writer) error {
+		if conf.format == "csv" {
+			return writeMultiCSV(w, rep)
+		}
+		writeMultiText(w, rep)
+		return nil
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to process geofeed %s: %w", conf.gf, err)
+	}
+	// The last MMDB is usually the most recent one.
+	last := rep.result.Databases[len(rep.result.Databases)-1]
+	if conf.failOnDiff && last.Differences > 0 {
+		return fmt.Errorf("%w: %d rows differ", errDifferences, last.Differences)
+	}
+	return nil
+}
+
+// compareGeofeed compares the geofeed against each of the MMDBs in conf.db
+// and returns the report. The error is that of verify.CompareGeofeed.
+func compareGeofeed(
+	ctx context.Context,
+	conf *config,
+	opts verify.Options,
+) (*multiReport, error) {
+	rep := &multiReport{mmdbs: conf.db}
+	var err error
+	rep.result, err = verify.CompareGeofeed(
+		ctx,
+		conf.gf,
+		conf.db,
+		conf.isp,
+		opts,
+		func(r verify.MultiRowResult) error {
+			if r.Err != nil || rep.differs(r) {
+				rep.rows = append(rep.rows, r)
+			}
+			return nil
+		},
+	)
+	return rep, err
+}
+
+// differs reports whether the row differs from any of the MMDBs.
+func (r *multiReport) differs(row verify.MultiRowResult) bool {
+	for i := range r.mmdbs {
+		if row.Differs(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// databases returns the MMDBs used in the comparison.
+func (r *multiReport) databases() []database {
+	var dbs []database
+	for i, d := range r.result.Databases {
+		dbs = append(dbs, database{Role: "MMDB " + r.mmdbs[i], DatabaseInfo: d.Database})
+	}
+	if r.result.ISPDatabase != nil {
+		dbs = append(dbs, database{Role: "ISP MMDB", DatabaseInfo: r.result.ISPDatabase})
+	}
+	return dbs
+}
+
+func writeMultiText(w io.Writer, rep *multiReport) {
+	for _, row := range rep.rows {
+		if row.Err != nil {
+			continue
+		}
+		c := row.Comparisons[0]
+		fmt.Fprintf(
+			w,
+			"\nLine %d: '%s', suggested: '%s'\n",
+			row.Line,
+			c.Network,
+			c.Suggested,
+		)
+		for i, c := range row.Comparisons {
+			if !row.Differs(i) {
+				fmt.Fprintf(w, "\t\t%s: matches\n", rep.mmdbs[i])
+				continue
+			}
+			fields := make([]string, 0, len(c.Differences))
+			for _, f := range c.Differences {
+				fields = append(fields, f.String())
+			}
+			fmt.Fprintf(
+				w,
+				"\t\t%s: differs in %s, current: '%s'\n",
+				rep.mmdbs[i],
+				strings.Join(fields, ", "),
+				c.Current,
+			)
+		}
+	}
+
+	fmt.Fprintf(w, "\nOut of %d potential corrections:\n", rep.result.Total)
+	for i, d := range rep.result.Databases {
+		fmt.Fprintf(
+			w,
+			"%s (%s): %d may be different than our current mappings",
+			rep.mmdbs[i],
+			d.Database,
+			d.Differences,
+		)
+		if i > 0 {
+			fmt.Fprintf(
+				w,
+				", %d picked up and %d no longer matching since %s",
+				d.Adopted,
+				d.Reverted,
+				rep.mmdbs[i-1],
+			)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// multiCSVHeader is the header of the CSV output when comparing against
+// several MMDBs.
+var multiCSVHeader = []string{
+	"network",
+	"line",
+	"mmdb",
+	"build_time",
+	"differences",
+	"current_country",
+	"suggested_country",
+	"current_region",
+	"suggested_region",
+	"current_city",
+	"suggested_city",
+	"current_postal_code",
+	"suggested_postal_code",
+}
+
+// writeMultiCSV writes a CSV row for each MMDB and geofeed row that differs
+// from any of the MMDBs.
+func writeMultiCSV(w io.Writer, rep *multiReport) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(multiCSVHeader); err != nil {
+		return err
+	}
+	for _, row := range rep.rows {
+		if row.Err != nil {
+			continue
+		}
+		for i, c := range row.Comparisons {
+			fields := make([]string, 0, len(c.Differences))
+			for _, f := range c.Differences {
+				fields = append(fields, f.String())
+			}
+			err := csvWriter.Write(csvSafe([]string{
+				c.Network,
+				strconv.Itoa(row.Line),
+				rep.mmdbs[i],
+				rep.result.Databases[i].Database.BuildTime().Format(time.RFC3339),
+				strings.Join(fields, ";"),
+				c.Current.Country,
+				c.Suggested.Country,
+				c.Current.Region,
+				c.Suggested.Region,
+				c.Current.City,
+				c.Suggested.City,
+				c.Current.PostalCode,
+				c.Suggested.PostalCode,
+			}))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
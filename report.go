@@ -0,0 +1,437 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/maxmind/mm-geofeed-verifier/v4/verify"
+)
+
+// formats are the supported output formats of the verification results.
+var formats = []string{"text", "sarif", "junit", "html", "csv", "markdown"}
+
+// locationFields are the location fields in geofeed order.
+var locationFields = []verify.Field{
+	verify.CountryField,
+	verify.RegionField,
+	verify.CityField,
+	verify.PostalCodeField,
+}
+
+// report holds the results of verifying a geofeed, as used by the output
+// formats.
+type report struct {
+	// geofeed is the path to the geofeed.
+	geofeed string
+	// compared is true if the geofeed was compared against an MMDB.
+	compared bool
+	// comparedISP is true if an ISP or ASN MMDB was used in the comparison.
+	comparedISP bool
+	result      verify.CheckResult
+	asnCounts   map[uint]int
+	// rows holds the rows that are invalid or differ from the MMDB, in
+	// geofeed order, unless they are written as they are verified.
+	rows []verify.RowResult
+	// maxRows is the number of rows kept in rows, or 0 to keep all of them.
+	maxRows int
+	// omitted is the number of rows that are invalid or differ from the MMDB
+	// but were not kept because of maxRows.
+	omitted int
+	// invalidCounts is the number of invalid rows of each type, including
+	// the ones not kept in rows.
+	invalidCounts map[verify.RowInvalidity]int
+	// empty is true if the geofeed has no rows and this is not allowed.
+	empty bool
+}
+
+// database is an MMDB used in the comparison, as described in the structured
+// output formats.
+type database struct {
+	// Role is "MMDB" or "ISP MMDB".
+	Role string `json:"role"`
+	*verify.DatabaseInfo
+}
+
+// databases returns the MMDBs used in the comparison.
+func (r *report) databases() []database {
+	var dbs []database
+	if r.result.Database != nil {
+		dbs = append(dbs, database{Role: "MMDB", DatabaseInfo: r.result.Database})
+	}
+	if r.result.ISPDatabase != nil {
+		dbs = append(dbs, database{Role: "ISP MMDB", DatabaseInfo: r.result.ISPDatabase})
+	}
+	return dbs
+}
+
+// rule is a check whose failures are reported in the structured output
+// formats.
+type rule struct {
+	id          string
+	description string
+}
+
+const (
+	emptyGeofeedRule = "EmptyGeofeed"
+	differenceRule   = "LocationDifference"
+)
+
+// rules are the checks reported in the structured output formats. There is a
+// rule for each verify.RowInvalidity.
+var rules = []rule{
+	{
+		verify.FewerFieldsThanExpected.String(),
+		"Rows must have the network, country, region, city and postal code fields",
+	},
+	{verify.EmptyNetwork.String(), "The network field must not be empty"},
+	{
+		verify.UnableToParseNetwork.String(),
+		"The network field must be an IP network in CIDR notation or an IP address",
+	},
+	{
+		verify.UnableToFindCityRecord.String(),
+		"The network must have a record in the MMDB",
+	},
+	{
+		verify.UnableToFindISPRecord.String(),
+		"The network must have a record in the ISP or ASN MMDB",
+	},
+	{
+		verify.InvalidRegionCode.String(),
+		"Region codes must be ISO 3166-2 codes including the country code (unless -lax is used)",
+	},
+	{emptyGeofeedRule, "The geofeed must have at least one row"},
+	{differenceRule, "The location in the geofeed differs from the MMDB"},
+}
+
+// mmdb returns the path to the MMDB to compare against, if any. It is only
+// used when there is at most one.
+func (c *config) mmdb() string {
+	if len(c.db) == 0 {
+		return ""
+	}
+	return c.db[0]
+}
+
+// maxReportedRows is the number of invalid or differing rows kept for the
+// formats that list the rows after their totals, i.e., sarif and junit. The
+// other rows are only counted, so that memory use does not depend on the
+// size of the geofeed.
+const maxReportedRows = 10_000
+
+func newReport(conf *config) *report {
+	return &report{
+		geofeed:       conf.gf,
+		compared:      len(conf.db) > 0,
+		comparedISP:   len(conf.db) > 0 && conf.isp != "",
+		invalidCounts: map[verify.RowInvalidity]int{},
+	}
+}
+
+// verifyGeofeed verifies the geofeed and returns the report with all the
+// rows that are invalid or differ from the MMDB. The error is that of
+// verify.StreamGeofeed; if it wraps verify.ErrInvalidGeofeed or
+// verify.ErrEmptyGeofeed, the report is complete.
+func verifyGeofeed(ctx context.Context, conf *config, opts verify.Options) (*report, error) {
+	rep := newReport(conf)
+	err := rep.verify(ctx, conf, opts, rep.add)
+	return rep, err
+}
+
+// verify verifies the geofeed, calling onRow with each row that is invalid or
+// differs from the MMDB as it is verified, and sets the results in the
+// report. The error is that of verify.StreamGeofeed.
+func (r *report) verify(
+	ctx context.Context,
+	conf *config,
+	opts verify.Options,
+	onRow func(verify.RowResult) error,
+) error {
+	c, asnCounts, err := verify.StreamGeofeed(
+		ctx,
+		conf.gf,
+		conf.mmdb(),
+		conf.isp,
+		opts,
+		func(row verify.RowResult) error {
+			if row.Err != nil {
+				r.invalidCounts[row.Err.Invalidity]++
+			}
+			if row.Err != nil || row.Diff != "" {
+				return onRow(row)
+			}
+			return nil
+		},
+	)
+	r.result = c
+	r.asnCounts = asnCounts
+	r.empty = errors.Is(err, verify.ErrEmptyGeofeed)
+	return err
+}
+
+// add keeps the row in the report, unless maxRows rows are already kept.
+func (r *report) add(row verify.RowResult) error {
+	if r.maxRows > 0 && len(r.rows) >= r.maxRows {
+		r.omitted++
+		return nil
+	}
+	r.rows = append(r.rows, row)
+	return nil
+}
+
+// rowWriter writes an output format as the rows are verified, so that the
+// rows need not be kept in memory.
+type rowWriter interface {
+	// writeRow writes a row that is invalid or differs from the MMDB.
+	writeRow(r verify.RowResult) error
+	// finish writes the rest of the output once all the rows are written.
+	finish(rep *report) error
+}
+
+// newRowWriter returns the rowWriter for the format, or nil if the format
+// needs the totals before the rows.
+func newRowWriter(w io.Writer, format string) rowWriter {
+	switch format {
+	case "text":
+		return &textWriter{w: w}
+	case "csv":
+		return newCSVWriter(w)
+	default:
+		return nil
+	}
+}
+
+// writeRows writes the rows kept in the report with rw.
+func writeRows(rw rowWriter, rep *report) error {
+	for _, r := range rep.rows {
+		if err := rw.writeRow(r); err != nil {
+			return err
+		}
+	}
+	return rw.finish(rep)
+}
+
+// sortedASNs returns the AS numbers of the rows, sorted by the number of rows
+// in descending order.
+func (r *report) sortedASNs() []uint {
+	// https://stackoverflow.com/questions/18695346/how-can-i-sort-a-mapstringint-by-its-values/56706305#56706305
+	asNumbers := make([]uint, 0, len(r.asnCounts))
+	for asNumber := range r.asnCounts {
+		asNumbers = append(asNumbers, asNumber)
+	}
+	slices.SortFunc(
+		asNumbers,
+		func(a, b uint) int {
+			return cmp.Or(
+				cmp.Compare(r.asnCounts[b], r.asnCounts[a]),
+				cmp.Compare(a, b),
+			)
+		},
+	)
+	return asNumbers
+}
+
+// count is the number of differing rows with a given key.
+type count struct {
+	key string
+	n   int
+}
+
+// asnCount is the number of differing rows in an autonomous system.
+type asnCount struct {
+	asNumber       uint
+	asOrganization string
+	n              int
+}
+
+// differences returns the comparisons of the rows that differ from the MMDB.
+func (r *report) differences() []*verify.Comparison {
+	var comparisons []*verify.Comparison
+	for _, row := range r.rows {
+		if row.Diff != "" && row.Comparison != nil {
+			comparisons = append(comparisons, row.Comparison)
+		}
+	}
+	return comparisons
+}
+
+// differencesByField returns the number of differing rows for each field.
+func (r *report) differencesByField() []count {
+	counts := map[string]int{}
+	for _, c := range r.differences() {
+		for _, f := range c.Differences {
+			counts[f.String()]++
+		}
+	}
+	return sortedCounts(counts)
+}
+
+// differencesByCountry returns the number of differing rows for each country
+// suggested by the geofeed.
+func (r *report) differencesByCountry() []count {
+	counts := map[string]int{}
+	for _, c := range r.differences() {
+		counts[strings.ToUpper(c.Suggested.Country)]++
+	}
+	return sortedCounts(counts)
+}
+
+// differencesByASN returns the number of differing rows for each autonomous
+// system. Rows without AS data are not counted.
+func (r *report) differencesByASN() []asnCount {
+	counts := map[uint]*asnCount{}
+	for _, c := range r.differences() {
+		if c.ASNumber == 0 {
+			continue
+		}
+		if counts[c.ASNumber] == nil {
+			counts[c.ASNumber] = &asnCount{
+				asNumber:       c.ASNumber,
+				asOrganization: c.ASOrganization,
+			}
+		}
+		counts[c.ASNumber].n++
+	}
+	asnCounts := make([]asnCount, 0, len(counts))
+	for _, c := range counts {
+		asnCounts = append(asnCounts, *c)
+	}
+	slices.SortFunc(asnCounts, func(a, b asnCount) int {
+		return cmp.Or(cmp.Compare(b.n, a.n), cmp.Compare(a.asNumber, b.asNumber))
+	})
+	return asnCounts
+}
+
+func sortedCounts(m map[string]int) []count {
+	counts := make([]count, 0, len(m))
+	for key, n := range m {
+		counts = append(counts, count{key: key, n: n})
+	}
+	slices.SortFunc(counts, func(a, b count) int {
+		return cmp.Or(cmp.Compare(b.n, a.n), cmp.Compare(a.key, b.key))
+	})
+	return counts
+}
+
+// diffMessage returns the description of a difference without the
+// indentation used in the text output.
+func diffMessage(diff string) string {
+	return strings.ReplaceAll(strings.TrimSpace(diff), "\n\t\t", "\n")
+}
+
+func writeReport(w io.Writer, format string, rep *report) error {
+	switch format {
+	case "sarif":
+		return writeSARIF(w, rep)
+	case "junit":
+		return writeJUnit(w, rep)
+	case "html":
+		return writeHTML(w, rep)
+	case "csv":
+		return writeCSV(w, rep)
+	case "markdown":
+		return writeMarkdown(w, rep)
+	default:
+		return writeText(w, rep)
+	}
+}
+
+// writeOutput calls write with the file at output or, if output is empty,
+// with stdout.
+func writeOutput(output string, write func(io.Writer) error) error {
+	if output == "" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(filepath.Clean(output))
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", output, err)
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %w", output, err)
+	}
+	return nil
+}
+
+func writeText(w io.Writer, rep *report) error {
+	return writeRows(&textWriter{w: w}, rep)
+}
+
+// textWriter writes the text output as the rows are verified.
+type textWriter struct {
+	w io.Writer
+	// diffs is the number of differences written so far.
+	diffs int
+}
+
+func (tw *textWriter) writeRow(r verify.RowResult) error {
+	if r.Diff == "" {
+		return nil
+	}
+	if tw.diffs > 0 {
+		if _, err := io.WriteString(tw.w, "\n"); err != nil {
+			return err
+		}
+	}
+	tw.diffs++
+	// The diff holds values from the geofeed, so it must not be part of a
+	// format string. It is terminated by a newline in case processing stops
+	// before the summary is written.
+	_, err := io.WriteString(tw.w, r.Diff+"\n")
+	return err
+}
+
+func (tw *textWriter) finish(rep *report) error {
+	w := tw.w
+	if !rep.compared {
+		fmt.Fprintf(
+			w,
+			"Validated %d rows. No MMDB provided (-db), so comparison was skipped.\n",
+			rep.result.Total,
+		)
+		return nil
+	}
+
+	if tw.diffs == 0 {
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(
+		w,
+		"\nOut of %d potential corrections, %d may be different than our current mappings\n\n",
+		rep.result.Total,
+		rep.result.Differences,
+	)
+	if rep.result.Differences > 0 {
+		d := rep.result.DifferenceCounts
+		fmt.Fprintf(
+			w,
+			"Differences by field: country: %d, region: %d, city: %d (city only: %d), "+
+				"postal code: %d\n\n",
+			d.Country,
+			d.Region,
+			d.City,
+			d.CityOnly,
+			d.PostalCode,
+		)
+	}
+
+	for _, asNumber := range rep.sortedASNs() {
+		fmt.Fprintf(w, "ASN: %d, count: %d\n", asNumber, rep.asnCounts[asNumber])
+	}
+
+	for _, db := range rep.databases() {
+		fmt.Fprintf(w, "%s: %s\n", db.Role, db.DatabaseInfo)
+	}
+	return nil
+}
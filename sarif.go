@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The types below are the subset of SARIF 2.1.0 used to report findings, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool        `json:"tool"`
+	Results    []sarifResult    `json:"results"`
+	Properties *sarifProperties `json:"properties,omitempty"`
+}
+
+// sarifProperties is the property bag of a run, which describes the MMDBs
+// used in the comparison and the number of rows without a result.
+type sarifProperties struct {
+	Databases []database `json:"databases,omitempty"`
+	// OmittedResults is the number of invalid or differing rows left out
+	// of the results after the first maxReportedRows.
+	OmittedResults int `json:"omittedResults,omitempty"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// sarifRegion is the line of a result. The columns of RowError are byte
+// indexes, whereas SARIF columns count characters, so they are left out.
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// sarifLevel returns the SARIF level of results for the rule. Differences
+// from the MMDB are warnings, everything else is an error.
+func sarifLevel(ruleID string) string {
+	if ruleID == differenceRule {
+		return "warning"
+	}
+	return "error"
+}
+
+// writeSARIF writes the report as a SARIF 2.1.0 log with one result per
+// invalid row or difference from the MMDB.
+func writeSARIF(w io.Writer, rep *report) error {
+	driver := sarifDriver{
+		Name:           "mm-geofeed-verifier",
+		Version:        version,
+		InformationURI: "https://github.com/maxmind/mm-geofeed-verifier",
+	}
+	ruleIndexes := map[string]int{}
+	for i, r := range rules {
+		ruleIndexes[r.id] = i
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   r.id,
+			ShortDescription:     sarifMessage{Text: r.description},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(r.id)},
+		})
+	}
+
+	artifact := sarifArtifact(rep.geofeed)
+	newResult := func(ruleID, message string, region *sarifRegion) sarifResult {
+		return sarifResult{
+			RuleID:    ruleID,
+			RuleIndex: ruleIndexes[ruleID],
+			Level:     sarifLevel(ruleID),
+			Message:   sarifMessage{Text: message},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: artifact,
+					Region:           region,
+				},
+			}},
+		}
+	}
+
+	results := []sarifResult{}
+	if rep.empty {
+		results = append(results, newResult(emptyGeofeedRule, "The geofeed is empty", nil))
+	}
+	for _, r := range rep.rows {
+		if r.Err != nil {
+			results = append(results, newResult(
+				r.Err.Invalidity.String(),
+				r.Err.Reason,
+				&sarifRegion{StartLine: r.Err.Line},
+			))
+			continue
+		}
+		results = append(results, newResult(
+			differenceRule,
+			diffMessage(r.Diff),
+			&sarifRegion{StartLine: r.Line},
+		))
+	}
+
+	run := sarifRun{
+		Tool:    sarifTool{Driver: driver},
+		Results: results,
+	}
+	if dbs := rep.databases(); len(dbs) > 0 || rep.omitted > 0 {
+		run.Properties = &sarifProperties{Databases: dbs, OmittedResults: rep.omitted}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+// sarifArtifact returns the location of the geofeed. Code-scanning tools
+// expect paths relative to the root of the repository, so if the geofeed is
+// in a git repository, the URI is relative to its root. Otherwise, it is an
+// absolute file URI.
+func sarifArtifact(geofeed string) sarifArtifactLocation {
+	path, err := filepath.Abs(geofeed)
+	if err != nil {
+		return sarifArtifactLocation{URI: filepath.ToSlash(geofeed)}
+	}
+	if root, ok := repositoryRoot(filepath.Dir(path)); ok {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			return sarifArtifactLocation{URI: filepath.ToSlash(rel), URIBaseID: "%SRCROOT%"}
+		}
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// Windows paths start with the volume name, e.g., "C:".
+		path = "/" + path
+	}
+	return sarifArtifactLocation{URI: (&url.URL{Scheme: "file", Path: path}).String()}
+}
+
+// repositoryRoot returns the closest directory to dir, dir included, that
+// has a .git directory or file, i.e., the root of the git repository or
+// worktree dir is in.
+func repositoryRoot(dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
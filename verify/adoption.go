@@ -0,0 +1,278 @@
+package verify
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// AdoptionRowResult is the result of tracking the adoption of a geofeed row
+// across builds of an MMDB.
+type AdoptionRowResult struct {
+	// Line is the line of the geofeed on which the row starts.
+	Line int
+	// Row holds the fields of the row.
+	Row []string
+	// Err describes why the row is invalid. It is nil for valid rows. A row
+	// is invalid if it is invalid for any of the builds.
+	Err *RowError
+	// Comparison holds the comparison of a valid row against the latest
+	// build.
+	Comparison *Comparison
+	// FirstMatch is the index of the first build that matched the row, or -1
+	// if none did or the row is invalid.
+	FirstMatch int
+}
+
+// Adopted reports whether the row matches the latest build.
+func (r AdoptionRowResult) Adopted() bool {
+	return r.Err == nil && len(r.Comparison.Differences) == 0
+}
+
+// AdoptionResult holds the results of tracking the adoption of a geofeed
+// across builds of an MMDB.
+type AdoptionResult struct {
+	MultiCheckResult
+	// MMDBs holds the paths to the builds, oldest first. Their results are in
+	// the same order in Databases.
+	MMDBs []string
+	// Unadopted is the number of valid rows that differ from the latest
+	// build.
+	Unadopted int
+}
+
+// TrackAdoption compares the geofeed against each of the MMDBs with the
+// ".mmdb" extension in mmdbDir, e.g., daily builds of a City database, and
+// calls handle with the first build that matched each row. The builds are
+// ordered by their build epoch, as read from their metadata, rather than by
+// name.
+//
+// The builds are opened one at a time: the geofeed is read once for each of
+// them, so opts.Progress reports each pass separately, and handle is called
+// during the last pass. Only a few bytes of state are kept per row between
+// passes.
+//
+// If mmdbDir has no MMDBs, an error wrapping ErrNoMMDB is returned. Otherwise,
+// the errors are those of StreamGeofeed.
+func TrackAdoption(
+	ctx context.Context,
+	geofeedFilename,
+	mmdbDir string,
+	opts Options,
+	handle func(AdoptionRowResult) error,
+) (AdoptionResult, error) {
+	t := adoptionTracker{
+		geofeedFilename: geofeedFilename,
+		opts:            opts,
+		cities:          newCityMatcher(opts),
+		handle:          handle,
+		invalidRows:     map[int]*RowError{},
+		checked:         NewCheckResult(),
+	}
+	var err error
+	t.result.MMDBs, err = listMMDBs(mmdbDir, opts)
+	if err != nil {
+		return t.result, err
+	}
+
+	for i := range t.result.MMDBs {
+		err := t.pass(ctx, i)
+		if err != nil && !errors.Is(err, ErrInvalidGeofeed) {
+			return t.result, err
+		}
+	}
+
+	t.result.Invalid = t.checked.Invalid
+	t.result.SampleInvalidRows = t.checked.SampleInvalidRows
+	if t.invalid.Invalid > 0 {
+		return t.result, &t.invalid
+	}
+	return t.result, nil
+}
+
+// adoptionTracker holds the state of TrackAdoption between its passes over
+// the geofeed.
+type adoptionTracker struct {
+	geofeedFilename string
+	opts            Options
+	cities          *cityMatcher
+	handle          func(AdoptionRowResult) error
+
+	result AdoptionResult
+	// rows holds the state of each row, in geofeed order.
+	rows []adoptionRow
+	// invalidRows holds the first error of each row that was invalid for any
+	// of the builds so far, by row index.
+	invalidRows map[int]*RowError
+	// checked and invalid collect the invalid rows during the last pass.
+	checked CheckResult
+	invalid InvalidGeofeedError
+}
+
+// adoptionRow is the state of a row between passes.
+type adoptionRow struct {
+	// firstMatch is the index of the first build that matched the row, or -1.
+	firstMatch int
+	// differs reports whether the row differs from the previous build.
+	differs bool
+}
+
+// pass compares the geofeed against the i-th build, which is closed before
+// returning.
+func (t *adoptionTracker) pass(ctx context.Context, i int) error {
+	filename := t.result.MMDBs[i]
+	db, err := openLocationMMDB(filename, t.opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	gf, err := openGeofeed(t.geofeedFilename, t.opts)
+	if err != nil {
+		return err
+	}
+	defer gf.Close()
+
+	t.result.Databases = append(t.result.Databases, DatabaseResult{
+		Database: newDatabaseInfo(db.Metadata),
+	})
+	v := &verifier{
+		db:     db,
+		opts:   t.opts,
+		cities: t.cities,
+		fields: databaseFields(db.Metadata.DatabaseType),
+	}
+
+	var k int
+	c, err := streamRows(
+		ctx,
+		gf,
+		t.geofeedFilename,
+		[]*verifier{v},
+		t.opts,
+		func(vr verifiedRow) error {
+			defer func() { k++ }()
+			return t.trackRow(i, k, vr)
+		},
+	)
+	t.result.Total = c.Total
+	if k != len(t.rows) && (err == nil || errors.Is(err, ErrInvalidGeofeed)) {
+		return t.changedError()
+	}
+	return err
+}
+
+// trackRow records the comparison of the k-th row against the i-th build
+// and, during the last pass, calls the handler.
+func (t *adoptionTracker) trackRow(i, k int, vr verifiedRow) error {
+	if i == 0 {
+		t.rows = append(t.rows, adoptionRow{firstMatch: -1})
+	} else if k >= len(t.rows) {
+		return t.changedError()
+	}
+	row := &t.rows[k]
+
+	rowErr, invalid := t.invalidRows[k]
+	switch {
+	case vr.err != nil:
+		if !invalid {
+			rowErr = vr.err
+			t.invalidRows[k] = rowErr
+		}
+	case !invalid:
+		differs := len(vr.comparisons[0].Differences) > 0
+		d := &t.result.Databases[i]
+		if differs {
+			d.Differences++
+		}
+		if i > 0 {
+			switch {
+			case row.differs && !differs:
+				d.Adopted++
+			case !row.differs && differs:
+				d.Reverted++
+			}
+		}
+		if !differs && row.firstMatch < 0 {
+			row.firstMatch = i
+		}
+		row.differs = differs
+	}
+
+	if i < len(t.result.MMDBs)-1 {
+		return nil
+	}
+
+	r := AdoptionRowResult{Line: vr.line, Row: vr.row, FirstMatch: -1}
+	if rowErr != nil {
+		r.Err = rowErr
+		t.checked.addInvalid(rowErr)
+		t.invalid.add(rowErr)
+	} else {
+		r.Comparison = vr.comparisons[0]
+		r.FirstMatch = row.firstMatch
+		if !r.Adopted() {
+			t.result.Unadopted++
+		}
+	}
+	return t.handle(r)
+}
+
+// changedError is returned when the number of rows in the geofeed changes
+// between passes.
+func (t *adoptionTracker) changedError() error {
+	if t.opts.HideFilePathsInErrorMessages {
+		return errors.New("the geofeed changed while tracking adoption")
+	}
+	return fmt.Errorf("geofeed %s changed while tracking adoption", t.geofeedFilename)
+}
+
+// listMMDBs returns the paths to the MMDBs in dir, ordered by build epoch
+// and then by name.
+func listMMDBs(dir string, opts Options) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		if opts.HideFilePathsInErrorMessages {
+			return nil, fmt.Errorf("unable to read MMDB directory: %w", err)
+		}
+		return nil, fmt.Errorf("unable to read MMDB directory %s: %w", dir, err)
+	}
+
+	type build struct {
+		filename string
+		epoch    uint
+	}
+	var builds []build
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".mmdb") {
+			continue
+		}
+		filename := filepath.Join(dir, entry.Name())
+		db, err := openLocationMMDB(filename, opts)
+		if err != nil {
+			return nil, err
+		}
+		builds = append(builds, build{filename: filename, epoch: db.Metadata.BuildEpoch})
+		db.Close()
+	}
+	if len(builds) == 0 {
+		if opts.HideFilePathsInErrorMessages {
+			return nil, fmt.Errorf("%w in the MMDB directory", ErrNoMMDB)
+		}
+		return nil, fmt.Errorf("%w in %s", ErrNoMMDB, dir)
+	}
+
+	slices.SortFunc(builds, func(a, b build) int {
+		return cmp.Or(cmp.Compare(a.epoch, b.epoch), cmp.Compare(a.filename, b.filename))
+	})
+	filenames := make([]string, len(builds))
+	for i, b := range builds {
+		filenames[i] = b.filename
+	}
+	return filenames, nil
+}
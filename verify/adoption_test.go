@@ -0,0 +1,159 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func copyTestFile(tb testing.TB, src, dst string) {
+	b, err := os.ReadFile(src)
+	require.NoError(tb, err)
+	require.NoError(tb, os.WriteFile(dst, b, 0o600))
+}
+
+func TestTrackAdoption(t *testing.T) {
+	dir := t.TempDir()
+	// The names sort in the opposite order of the build epochs.
+	copyTestFile(t, cityTestDatabase, filepath.Join(dir, "b.mmdb"))
+	copyTestFile(
+		t,
+		writeMatchingTestMMDB(t),
+		filepath.Join(dir, "a.mmdb"),
+	)
+	// Files without the .mmdb extension are ignored.
+	copyTestFile(t, "test_data/geofeed-valid.csv", filepath.Join(dir, "geofeed.csv"))
+
+	var results []AdoptionRowResult
+	a, err := TrackAdoption(
+		t.Context(),
+		"test_data/geofeed-valid.csv",
+		dir,
+		Options{},
+		func(r AdoptionRowResult) error {
+			results = append(results, r)
+			return nil
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]string{filepath.Join(dir, "b.mmdb"), filepath.Join(dir, "a.mmdb")},
+		a.MMDBs,
+	)
+	assert.Equal(t, 3, a.Total)
+	assert.Zero(t, a.Unadopted)
+	require.Len(t, a.Databases, 2)
+	assert.Equal(t, cityTestDatabaseInfo, a.Databases[0].Database)
+	assert.Equal(t, 2, a.Databases[1].Adopted)
+
+	require.Len(t, results, 3)
+	for i, firstMatch := range []int{1, 1, 0} {
+		assert.Equal(t, firstMatch, results[i].FirstMatch, "line %d", results[i].Line)
+		assert.True(t, results[i].Adopted(), "line %d", results[i].Line)
+	}
+}
+
+func TestTrackAdoption_Unadopted(t *testing.T) {
+	dir := t.TempDir()
+	copyTestFile(t, cityTestDatabase, filepath.Join(dir, "GeoIP2-City.mmdb"))
+
+	var results []AdoptionRowResult
+	a, err := TrackAdoption(
+		t.Context(),
+		"test_data/geofeed-invalid-comments.csv",
+		dir,
+		Options{},
+		func(r AdoptionRowResult) error {
+			results = append(results, r)
+			return nil
+		},
+	)
+	require.ErrorIs(t, err, ErrInvalidGeofeed)
+	assert.Equal(t, 1, a.Unadopted)
+	require.Len(t, results, 4)
+	for _, r := range results {
+		if r.Err != nil {
+			assert.Equal(t, -1, r.FirstMatch)
+			assert.False(t, r.Adopted())
+		}
+	}
+}
+
+// TestTrackAdoption_CompareGeofeed checks that tracking the adoption one build
+// at a time gives the same results as comparing against all of them at once.
+func TestTrackAdoption_CompareGeofeed(t *testing.T) {
+	dir := t.TempDir()
+	copyTestFile(t, cityTestDatabase, filepath.Join(dir, "a.mmdb"))
+	copyTestFile(
+		t,
+		writeMatchingTestMMDB(t),
+		filepath.Join(dir, "b.mmdb"),
+	)
+	geofeed := "test_data/geofeed-invalid-comments.csv"
+
+	var results []AdoptionRowResult
+	a, err := TrackAdoption(
+		t.Context(),
+		geofeed,
+		dir,
+		Options{},
+		func(r AdoptionRowResult) error {
+			results = append(results, r)
+			return nil
+		},
+	)
+	require.ErrorIs(t, err, ErrInvalidGeofeed)
+
+	var want []MultiRowResult
+	mc, err := CompareGeofeed(
+		t.Context(),
+		geofeed,
+		a.MMDBs,
+		"",
+		Options{},
+		func(r MultiRowResult) error {
+			want = append(want, r)
+			return nil
+		},
+	)
+	require.ErrorIs(t, err, ErrInvalidGeofeed)
+	assert.Equal(t, mc, a.MultiCheckResult)
+
+	require.Len(t, results, len(want))
+	for i, r := range results {
+		assert.Equal(t, want[i].Line, r.Line)
+		assert.Equal(t, want[i].Err, r.Err, "line %d", r.Line)
+		if r.Err == nil {
+			assert.Equal(t, want[i].Comparisons[1], r.Comparison, "line %d", r.Line)
+		}
+	}
+}
+
+func TestTrackAdoption_NoMMDB(t *testing.T) {
+	dir := t.TempDir()
+	copyTestFile(t, "test_data/geofeed-valid.csv", filepath.Join(dir, "geofeed.csv"))
+
+	_, err := TrackAdoption(
+		t.Context(),
+		"test_data/geofeed-valid.csv",
+		dir,
+		Options{},
+		func(AdoptionRowResult) error { return nil },
+	)
+	require.ErrorIs(t, err, ErrNoMMDB)
+	assert.ErrorContains(t, err, dir)
+
+	_, err = TrackAdoption(
+		t.Context(),
+		"test_data/geofeed-valid.csv",
+		filepath.Join(dir, "does-not-exist"),
+		Options{HideFilePathsInErrorMessages: true},
+		func(AdoptionRowResult) error { return nil },
+	)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorContains(t, err, "unable to read MMDB directory: ")
+}
@@ -0,0 +1,250 @@
+package verify
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// CityMatch describes how the city name in a geofeed row matches the city
+// name in the MMDB.
+type CityMatch int
+
+// City match types.
+const (
+	// CityMismatch indicates different city names.
+	CityMismatch CityMatch = iota
+	// CityExact indicates city names that are equal, ignoring case.
+	CityExact
+	// CityEquivalent indicates city names that are equal after Unicode
+	// normalization, removing diacritics and punctuation, and replacing
+	// equivalent names, e.g., "Sao Paulo" and "São Paulo" or "St. Louis"
+	// and "Saint Louis".
+	CityEquivalent
+	// CityPrefix indicates city names where, after the same normalization,
+	// the words of one are the first words of the other, e.g., "Frankfurt"
+	// and "Frankfurt am Main".
+	CityPrefix
+)
+
+// String implements the Stringer interface.
+func (m CityMatch) String() string {
+	switch m {
+	case CityMismatch:
+		return "mismatch"
+	case CityExact:
+		return "exact"
+	case CityEquivalent:
+		return "equivalent"
+	case CityPrefix:
+		return "prefix"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m CityMatch) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// DefaultCityEquivalents are the city name equivalents used if
+// Options.CityEquivalents is nil. They expand common abbreviations.
+var DefaultCityEquivalents = map[string]string{
+	"St":  "Saint",
+	"Ste": "Sainte",
+	"Mt":  "Mount",
+	"Ft":  "Fort",
+}
+
+// cityRule replaces the words from with the words to.
+type cityRule struct {
+	from []string
+	to   []string
+}
+
+// cityMatcher compares city names.
+type cityMatcher struct {
+	rules []cityRule
+	// exact disables treating equivalent names and prefixes as equal.
+	exact bool
+}
+
+func newCityMatcher(opts Options) *cityMatcher {
+	equivalents := opts.CityEquivalents
+	if equivalents == nil {
+		equivalents = DefaultCityEquivalents
+	}
+
+	m := &cityMatcher{exact: opts.ExactCityMatch}
+	for from, to := range equivalents {
+		rule := cityRule{from: cityNameWords(from), to: cityNameWords(to)}
+		if len(rule.from) > 0 {
+			m.rules = append(m.rules, rule)
+		}
+	}
+	// Longer names are replaced first, so that, e.g., "Frankfurt am Main"
+	// takes precedence over "Main".
+	slices.SortFunc(m.rules, func(a, b cityRule) int {
+		return cmp.Or(
+			cmp.Compare(len(b.from), len(a.from)),
+			slices.Compare(a.from, b.from),
+		)
+	})
+	return m
+}
+
+// match returns how the suggested city name matches the current one.
+func (m *cityMatcher) match(suggested, current string) CityMatch {
+	if strings.EqualFold(suggested, current) {
+		return CityExact
+	}
+	return matchWords(m.canonical(suggested), m.canonical(current))
+}
+
+// matchNames returns how the suggested city name matches the best matching
+// of the localized names of a city, along with the locale of that name. The
+// name in the preferred locale is tried first. If no name matches, the locale
+// is empty.
+func (m *cityMatcher) matchNames(
+	suggested string,
+	names map[string]string,
+	preferred string,
+) (CityMatch, string) {
+	if len(names) == 0 {
+		return m.match(suggested, ""), ""
+	}
+
+	locales := slices.Sorted(maps.Keys(names))
+	if i := slices.Index(locales, preferred); i > 0 {
+		locales = slices.Insert(slices.Delete(locales, i, i+1), 0, preferred)
+	}
+
+	for _, locale := range locales {
+		if strings.EqualFold(suggested, names[locale]) {
+			return CityExact, locale
+		}
+	}
+	// Only canonicalize the names if none is an exact match, and the suggested
+	// name only once.
+	words := m.canonical(suggested)
+	// Prefixes are only matched against the name in the preferred locale,
+	// falling back to English, as names in other locales may start with the
+	// name of another city, e.g., "Monaco di Baviera", Italian for Munich.
+	prefixLocale := preferred
+	if _, ok := names[preferred]; !ok {
+		prefixLocale = "en"
+	}
+	match, matchLocale := CityMismatch, ""
+	for _, locale := range locales {
+		switch matchWords(words, m.canonical(names[locale])) {
+		case CityEquivalent:
+			return CityEquivalent, locale
+		case CityPrefix:
+			if locale == prefixLocale {
+				match, matchLocale = CityPrefix, locale
+			}
+		}
+	}
+	return match, matchLocale
+}
+
+// matchWords returns how two canonical city names match. Names without words,
+// e.g., consisting of punctuation only, do not match any name.
+func matchWords(a, b []string) CityMatch {
+	switch {
+	case len(a) == 0 || len(b) == 0:
+		return CityMismatch
+	case slices.Equal(a, b):
+		return CityEquivalent
+	case hasPrefix(a, b) || hasPrefix(b, a):
+		return CityPrefix
+	default:
+		return CityMismatch
+	}
+}
+
+// hasPrefix reports whether the words start with the words of prefix.
+func hasPrefix(words, prefix []string) bool {
+	return len(prefix) <= len(words) && slices.Equal(words[:len(prefix)], prefix)
+}
+
+// equal reports whether the city names should be considered equal.
+func (m *cityMatcher) equal(match CityMatch) bool {
+	return match == CityExact || ((match == CityEquivalent || match == CityPrefix) && !m.exact)
+}
+
+// canonical returns the words of a city name after replacing equivalents.
+func (m *cityMatcher) canonical(name string) []string {
+	words := cityNameWords(name)
+	for _, rule := range m.rules {
+		words = replaceWords(words, rule.from, rule.to)
+	}
+	return words
+}
+
+// replaceWords replaces each occurrence of the sequence of words from in
+// words with to.
+func replaceWords(words, from, to []string) []string {
+	var replaced []string
+	for i := 0; i < len(words); {
+		if i+len(from) <= len(words) && slices.Equal(words[i:i+len(from)], from) {
+			replaced = append(replaced, to...)
+			i += len(from)
+			continue
+		}
+		replaced = append(replaced, words[i])
+		i++
+	}
+	return replaced
+}
+
+// foldLetters replaces letters that Unicode decomposition does not reduce to
+// ASCII.
+var foldLetters = strings.NewReplacer(
+	"ß", "ss",
+	"æ", "ae",
+	"œ", "oe",
+	"ø", "o",
+	"ł", "l",
+	"đ", "d",
+	"ð", "d",
+	"þ", "th",
+	"ı", "i",
+)
+
+// cityNameWords returns the lowercase words of a city name with diacritics
+// removed. Punctuation separates words.
+func cityNameWords(name string) []string {
+	folded := strings.ToLower(name)
+	if !isASCII(folded) {
+		folded = norm.NFC.String(strings.Map(removeMark, norm.NFKD.String(folded)))
+		folded = foldLetters.Replace(folded)
+	}
+	return strings.FieldsFunc(folded, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// removeMark is a strings.Map function that drops nonspacing marks, i.e.,
+// the diacritics left over by Unicode decomposition.
+func removeMark(r rune) rune {
+	if unicode.Is(unicode.Mn, r) {
+		return -1
+	}
+	return r
+}
+
+func isASCII(s string) bool {
+	for i := range len(s) {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
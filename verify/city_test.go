@@ -0,0 +1,138 @@
+package verify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCityMatcher(t *testing.T) {
+	m := newCityMatcher(Options{
+		CityEquivalents: map[string]string{
+			"St":                "Saint",
+			"Frankfurt am Main": "Frankfurt",
+		},
+	})
+
+	tests := []struct {
+		suggested string
+		current   string
+		match     CityMatch
+	}{
+		{"Milton", "Milton", CityExact},
+		{"MILTON", "milton", CityExact},
+		{"", "", CityExact},
+		{"Sao Paulo", "São Paulo", CityEquivalent},
+		{"SÃO PAULO", "São Paulo", CityExact},
+		{"SAO PAULO", "São Paulo", CityEquivalent},
+		{"Linkoping", "Linköping", CityEquivalent},
+		// NFD and NFC forms of "Zürich".
+		{"Zu\u0308rich", "Z\u00fcrich", CityEquivalent},
+		{"Muenchen", "München", CityMismatch},
+		{"Strasse", "Straße", CityEquivalent},
+		{"AEROSKOBING", "ÆRØSKØBING", CityEquivalent},
+		{"St. Louis", "Saint Louis", CityEquivalent},
+		{"St Louis", "Saint-Louis", CityEquivalent},
+		{"Frankfurt am Main", "Frankfurt", CityEquivalent},
+		{"Frankfurt (Oder)", "Frankfurt", CityPrefix},
+		{"Frankfurt", "Frankfurt an der Oder", CityPrefix},
+		{"York", "New York", CityMismatch},
+		{"Stockholm", "St", CityMismatch},
+		{"Parsippany", "", CityMismatch},
+		{"", "Parsippany", CityMismatch},
+		// Names without words are not equivalent to each other.
+		{"-", ".", CityMismatch},
+		{"?", "", CityMismatch},
+		{"Boston", "Austin", CityMismatch},
+	}
+	for _, test := range tests {
+		t.Run(test.suggested+" "+test.current, func(t *testing.T) {
+			assert.Equal(t, test.match, m.match(test.suggested, test.current))
+		})
+	}
+}
+
+func TestCityMatcher_Defaults(t *testing.T) {
+	m := newCityMatcher(Options{})
+	assert.Equal(t, CityEquivalent, m.match("Ste. Foy", "Sainte-Foy"))
+	assert.True(t, m.equal(CityEquivalent))
+	assert.True(t, m.equal(CityPrefix))
+
+	// The examples of names that should not be reported as differences.
+	for _, names := range [][2]string{
+		{"Sao Paulo", "São Paulo"},
+		{"St. Louis", "Saint Louis"},
+		{"Frankfurt am Main", "Frankfurt"},
+	} {
+		assert.True(t, m.equal(m.match(names[0], names[1])), names)
+	}
+
+	m = newCityMatcher(Options{ExactCityMatch: true})
+	assert.Equal(t, CityEquivalent, m.match("St. Louis", "Saint Louis"))
+	assert.Equal(t, CityPrefix, m.match("Frankfurt am Main", "Frankfurt"))
+	assert.False(t, m.equal(CityEquivalent))
+	assert.False(t, m.equal(CityPrefix))
+	assert.True(t, m.equal(CityExact))
+}
+
+func TestCityMatcher_MatchNames(t *testing.T) {
+	m := newCityMatcher(Options{})
+	names := map[string]string{
+		"de":    "München",
+		"en":    "Munich",
+		"fr":    "Munich",
+		"it":    "Monaco di Baviera",
+		"zh-CN": "慕尼黑",
+	}
+
+	tests := []struct {
+		suggested string
+		preferred string
+		match     CityMatch
+		locale    string
+	}{
+		{"Munich", "en", CityExact, "en"},
+		{"Munich", "fr", CityExact, "fr"},
+		{"München", "en", CityExact, "de"},
+		{"Munchen", "en", CityEquivalent, "de"},
+		{"慕尼黑", "en", CityExact, "zh-CN"},
+		{"Monaco", "en", CityMismatch, ""},
+		{"Munich, Bavaria", "en", CityPrefix, "en"},
+		{"Munich, Bavaria", "de", CityMismatch, ""},
+		{"Munich, Bavaria", "es", CityPrefix, "en"},
+		{"Monaco", "it", CityPrefix, "it"},
+	}
+	for _, test := range tests {
+		t.Run(test.suggested+" "+test.preferred, func(t *testing.T) {
+			match, locale := m.matchNames(test.suggested, names, test.preferred)
+			assert.Equal(t, test.match, match)
+			assert.Equal(t, test.locale, locale)
+		})
+	}
+
+	match, locale := m.matchNames("", nil, "en")
+	assert.Equal(t, CityExact, match)
+	assert.Empty(t, locale)
+}
+
+func BenchmarkCityMatcher_MatchNames(b *testing.B) {
+	m := newCityMatcher(Options{})
+	names := map[string]string{
+		"de":    "München",
+		"en":    "Munich",
+		"es":    "Múnich",
+		"fr":    "Munich",
+		"ja":    "ミュンヘン",
+		"pt-BR": "Munique",
+		"ru":    "Мюнхен",
+		"zh-CN": "慕尼黑",
+	}
+
+	for _, suggested := range []string{"Munich", "Munchen", "Milton"} {
+		b.Run(suggested, func(b *testing.B) {
+			for b.Loop() {
+				m.matchNames(suggested, names, "en")
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field identifies a location field of a geofeed row.
+type Field int
+
+// Location fields.
+const (
+	CountryField Field = iota
+	RegionField
+	CityField
+	PostalCodeField
+)
+
+// String implements the Stringer interface.
+func (f Field) String() string {
+	switch f {
+	case CountryField:
+		return "country"
+	case RegionField:
+		return "region"
+	case CityField:
+		return "city"
+	case PostalCodeField:
+		return "postal code"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (f Field) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// DifferenceCounts holds the number of rows that differ from the MMDB in each
+// field. A row that differs in several fields is counted for each of them.
+type DifferenceCounts struct {
+	// Country is the number of rows that differ in country, i.e., the
+	// country-level disagreements, which usually matter the most.
+	Country    int `json:"country"`
+	Region     int `json:"region"`
+	City       int `json:"city"`
+	PostalCode int `json:"postal_code"`
+	// CityOnly is the number of rows that differ in city and in no other
+	// field.
+	CityOnly int `json:"city_only"`
+}
+
+// add counts a row that differs in the given fields.
+func (d *DifferenceCounts) add(fields []Field) {
+	for _, f := range fields {
+		switch f {
+		case CountryField:
+			d.Country++
+		case RegionField:
+			d.Region++
+		case CityField:
+			d.City++
+		case PostalCodeField:
+			d.PostalCode++
+		}
+	}
+	if len(fields) == 1 && fields[0] == CityField {
+		d.CityOnly++
+	}
+}
+
+// Value returns the value of field f.
+func (l Location) Value(f Field) string {
+	switch f {
+	case CountryField:
+		return l.Country
+	case RegionField:
+		return l.Region
+	case CityField:
+		return l.City
+	case PostalCodeField:
+		return l.PostalCode
+	default:
+		return ""
+	}
+}
+
+// Comparison is the result of comparing a valid geofeed row against the
+// MMDBs.
+type Comparison struct {
+	// Network is the network of the row. Single IP addresses have a prefix
+	// length added.
+	Network string `json:"network"`
+	// Suggested is the location in the geofeed.
+	Suggested Location `json:"suggested"`
+	// Current is the location in the MMDB. Its region is the most specific
+	// subdivision, prefixed with the country code only if the suggested
+	// region is.
+	Current Location `json:"current"`
+	// Fields lists the location fields provided by the MMDB, which are the
+	// ones compared, e.g., only CountryField for Country databases.
+	Fields []Field `json:"fields"`
+	// Differences lists the fields whose suggested value differs from the
+	// current one. Regions that match a less specific subdivision are not
+	// differences. Postal codes are only compared if the geofeed has one.
+	// The city of rows closer to the MMDB location than Options.MinDistance
+	// is not a difference.
+	// Only the fields provided by the MMDB are compared, e.g., only the
+	// country for Country databases.
+	Differences []Field `json:"differences"`
+	// RegionMatch describes how the suggested region matches the
+	// subdivisions in the MMDB.
+	RegionMatch RegionMatch `json:"region_match"`
+	// RegionLevel is the level of the subdivision that the suggested region
+	// matched, 1 being the least specific one, e.g., 1 for GB-ENG and 2 for
+	// GB-WBK. It is 0 if no subdivision matched.
+	RegionLevel int `json:"region_level,omitempty"`
+	// CityMatch describes how the suggested city name matches the current
+	// one. Equivalent names are only reported as a difference if
+	// Options.ExactCityMatch is set.
+	CityMatch CityMatch `json:"city_match"`
+	// CityLocale is the locale of the MMDB city name that the suggested city
+	// name matched, e.g., "de" for "München". It is empty if no name matched.
+	CityLocale string `json:"city_locale,omitempty"`
+	// Distance is the distance in kilometers between the suggested city, as
+	// found in Options.Gazetteer, and the location in the MMDB. It is nil if
+	// either is unknown.
+	Distance *float64 `json:"distance_km,omitempty"`
+	// AccuracyRadius is the radius in kilometers around the location in the
+	// MMDB in which the addresses are likely to be. It is only set along with
+	// Distance.
+	AccuracyRadius uint16 `json:"accuracy_radius_km,omitempty"`
+	// ASNumber, ASOrganization and ISP are from the ISP MMDB, if one was
+	// provided.
+	ASNumber       uint   `json:"as_number,omitempty"`
+	ASOrganization string `json:"as_organization,omitempty"`
+	ISP            string `json:"isp,omitempty"`
+}
+
+// diff returns the description of the differences, in the format of the diff
+// lines returned by ProcessGeofeed, or "" if there are none.
+func (c *Comparison) diff() string {
+	if len(c.Differences) == 0 {
+		return ""
+	}
+
+	const indent = "\t\t"
+
+	lines := []string{fmt.Sprintf("\nFound a potential improvement: '%s'", c.Network)}
+	for _, f := range c.Differences {
+		lines = append(
+			lines,
+			fmt.Sprintf(
+				"current %s: '%s'%ssuggested %s: '%s'",
+				f,
+				c.Current.Value(f),
+				indent,
+				f,
+				c.Suggested.Value(f),
+			),
+		)
+	}
+	if c.Distance != nil {
+		lines = append(
+			lines,
+			fmt.Sprintf(
+				"Distance: %.1f km (accuracy radius: %d km)",
+				*c.Distance,
+				c.AccuracyRadius,
+			),
+		)
+	}
+	if c.ASNumber > 0 {
+		lines = append(lines, fmt.Sprintf("AS Number: %d", c.ASNumber))
+	}
+	if c.ASOrganization != "" {
+		lines = append(lines, "AS Name: "+c.ASOrganization)
+	}
+	if c.ISP != "" {
+		lines = append(lines, "ISP Name: "+c.ISP)
+	}
+	return strings.Join(lines, "\n"+indent)
+}
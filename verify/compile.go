@@ -0,0 +1,140 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"strings"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/inserter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// compiledDatabaseType is the database type of MMDBs compiled without a base
+// MMDB. Names starting with "GeoIP" are reserved for MaxMind databases.
+const compiledDatabaseType = "Geofeed-City"
+
+// geofeedRecordKeys are the top-level keys of City records that are set from
+// geofeed rows.
+var geofeedRecordKeys = []mmdbtype.String{"country", "subdivisions", "city", "postal"}
+
+// CompileGeofeed writes an MMDB to w with the locations from the geofeed at
+// geofeedFilename. If baseMMDBFilename is not empty, the geofeed is overlaid
+// on that City MMDB: for networks in the geofeed, the country, subdivisions,
+// city and postal data are replaced with the values from the geofeed while
+// the rest of the record, e.g., the location, is kept. Otherwise, a
+// standalone MMDB containing only the geofeed's networks is written. In both
+// cases, the records can be read in the same way as City records.
+//
+// The geofeed must be valid. If it is not, the returned CheckResult holds the
+// validation results and the error wraps ErrInvalidGeofeed or
+// ErrEmptyGeofeed.
+func CompileGeofeed(
+	geofeedFilename,
+	baseMMDBFilename string,
+	w io.Writer,
+	opts Options,
+) (CheckResult, error) {
+	entries, c, err := readEntries(geofeedFilename, opts)
+	if err != nil {
+		return c, err
+	}
+
+	writerOpts := mmdbwriter.Options{
+		// Geofeeds may include private networks, e.g., for testing.
+		IncludeReservedNetworks: true,
+	}
+
+	var tree *mmdbwriter.Tree
+	if baseMMDBFilename != "" {
+		tree, err = mmdbwriter.Load(filepath.Clean(baseMMDBFilename), writerOpts)
+		if err != nil {
+			if opts.HideFilePathsInErrorMessages {
+				return c, fmt.Errorf("unable to load MMDB: %w", err)
+			}
+			return c, fmt.Errorf("unable to load MMDB %s: %w", baseMMDBFilename, err)
+		}
+	} else {
+		writerOpts.DatabaseType = compiledDatabaseType
+		writerOpts.Languages = []string{"en"}
+		writerOpts.Description = map[string]string{
+			"en": "Locations compiled from a geofeed",
+		}
+		tree, err = mmdbwriter.New(writerOpts)
+		if err != nil {
+			return c, fmt.Errorf("unable to create MMDB: %w", err)
+		}
+	}
+
+	for _, r := range flatten(entries) {
+		record := locationRecord(r.loc)
+		for _, network := range rangePrefixes(r.start, r.end) {
+			err := tree.InsertFunc(ipNet(network), overlayRecord(record))
+			if err != nil {
+				return c, fmt.Errorf("unable to insert %s: %w", network, err)
+			}
+		}
+	}
+
+	if _, err := tree.WriteTo(w); err != nil {
+		return c, fmt.Errorf("unable to write MMDB: %w", err)
+	}
+	return c, nil
+}
+
+// locationRecord returns the City record fields for loc. Empty geofeed fields
+// are left out of the record.
+func locationRecord(loc Location) mmdbtype.Map {
+	record := mmdbtype.Map{}
+	country := strings.ToUpper(loc.Country)
+	if country != "" {
+		record["country"] = mmdbtype.Map{"iso_code": mmdbtype.String(country)}
+	}
+	if loc.Region != "" {
+		// MMDB subdivision codes do not include the country code.
+		_, region, found := strings.Cut(loc.Region, "-")
+		if !found {
+			region = loc.Region
+		}
+		record["subdivisions"] = mmdbtype.Slice{
+			mmdbtype.Map{"iso_code": mmdbtype.String(strings.ToUpper(region))},
+		}
+	}
+	if loc.City != "" {
+		record["city"] = mmdbtype.Map{
+			"names": mmdbtype.Map{"en": mmdbtype.String(loc.City)},
+		}
+	}
+	if loc.PostalCode != "" {
+		record["postal"] = mmdbtype.Map{"code": mmdbtype.String(loc.PostalCode)}
+	}
+	return record
+}
+
+// overlayRecord returns an inserter that replaces the geofeed fields of an
+// existing record with those in record, keeping any other fields.
+func overlayRecord(record mmdbtype.Map) inserter.Func {
+	return func(existing mmdbtype.DataType) (mmdbtype.DataType, error) {
+		existingMap, ok := existing.(mmdbtype.Map)
+		if !ok {
+			return record, nil
+		}
+		merged := maps.Clone(existingMap)
+		for _, key := range geofeedRecordKeys {
+			delete(merged, key)
+		}
+		maps.Copy(merged, record)
+		return merged, nil
+	}
+}
+
+func ipNet(p netip.Prefix) *net.IPNet {
+	return &net.IPNet{
+		IP:   p.Addr().AsSlice(),
+		Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen()),
+	}
+}
@@ -0,0 +1,134 @@
+package verify
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileGeofeed(t *testing.T) {
+	tests := []struct {
+		desc     string
+		base     string
+		dbType   string
+		ip       string
+		expected Location
+	}{
+		{
+			desc:   "overlay, network in geofeed",
+			base:   "test_data/GeoIP2-City-Test.mmdb",
+			dbType: "GeoIP2-City",
+			ip:     "202.196.224.5",
+			expected: Location{
+				Country:    "AT",
+				Region:     "AT-9",
+				City:       "Vienna",
+				PostalCode: "1060",
+			},
+		},
+		{
+			desc:   "overlay, network not in geofeed",
+			base:   "test_data/GeoIP2-City-Test.mmdb",
+			dbType: "GeoIP2-City",
+			ip:     "216.160.83.56",
+			expected: Location{
+				Country:    "US",
+				Region:     "US-WA",
+				City:       "Milton",
+				PostalCode: "98354",
+			},
+		},
+		{
+			desc:   "standalone, network in geofeed",
+			dbType: compiledDatabaseType,
+			ip:     "2a02:ecc0::1",
+			expected: Location{
+				Country: "US",
+				Region:  "US-NJ",
+				City:    "Parsippany",
+			},
+		},
+		{
+			desc:   "standalone, network not in geofeed",
+			dbType: compiledDatabaseType,
+			ip:     "216.160.83.56",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			c, err := CompileGeofeed("test_data/geofeed-valid.csv", test.base, &buf, Options{})
+			require.NoError(t, err)
+			assert.Equal(t, 3, c.Total)
+
+			db, err := maxminddb.OpenBytes(buf.Bytes())
+			require.NoError(t, err)
+			defer db.Close()
+			assert.Equal(t, test.dbType, db.Metadata.DatabaseType)
+
+			var record cityRecord
+			require.NoError(t, db.Lookup(netip.MustParseAddr(test.ip)).Decode(&record))
+			assert.Equal(t, test.expected, record.location())
+		})
+	}
+}
+
+func TestCompileGeofeed_SingleAddress(t *testing.T) {
+	gf := filepath.Join(t.TempDir(), "geofeed.csv")
+	require.NoError(t, os.WriteFile(gf, []byte("2a02:ecc0::1,DE,DE-BE,Berlin,\n"), 0o600))
+
+	var buf bytes.Buffer
+	_, err := CompileGeofeed(gf, "test_data/GeoIP2-City-Test.mmdb", &buf, Options{})
+	require.NoError(t, err)
+
+	db, err := maxminddb.OpenBytes(buf.Bytes())
+	require.NoError(t, err)
+	defer db.Close()
+
+	var record cityRecord
+	require.NoError(t, db.Lookup(netip.MustParseAddr("2a02:ecc0::1")).Decode(&record))
+	assert.Equal(t, "DE", record.location().Country)
+
+	// The rest of the /64 keeps the base MMDB's location.
+	record = cityRecord{}
+	require.NoError(t, db.Lookup(netip.MustParseAddr("2a02:ecc0::2")).Decode(&record))
+	assert.Equal(t, "AZ", record.location().Country)
+}
+
+func TestCompileGeofeed_KeepsOtherFields(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := CompileGeofeed(
+		"test_data/geofeed-valid.csv",
+		"test_data/GeoIP2-City-Test.mmdb",
+		&buf,
+		Options{},
+	)
+	require.NoError(t, err)
+
+	db, err := maxminddb.OpenBytes(buf.Bytes())
+	require.NoError(t, err)
+	defer db.Close()
+
+	var timeZone string
+	require.NoError(
+		t,
+		db.Lookup(netip.MustParseAddr("2.125.160.216")).
+			DecodePath(&timeZone, "location", "time_zone"),
+	)
+	assert.Equal(t, "Europe/London", timeZone)
+}
+
+func TestCompileGeofeed_Invalid(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := CompileGeofeed("test_data/geofeed-invalid-network.csv", "", &buf, Options{})
+	require.ErrorIs(t, err, ErrInvalidGeofeed)
+	assert.Equal(t, 1, c.Invalid)
+	assert.Zero(t, buf.Len())
+}
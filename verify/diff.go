@@ -0,0 +1,445 @@
+package verify
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Location holds the location fields of a geofeed row.
+type Location struct {
+	Country    string `json:"country"`
+	Region     string `json:"region"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code"`
+}
+
+// String returns the location in the geofeed field order.
+func (l Location) String() string {
+	return strings.Join([]string{l.Country, l.Region, l.City, l.PostalCode}, ",")
+}
+
+// regionCode returns the region code prefixed with the country code, as it
+// would be written in strict mode.
+func (l Location) regionCode() string {
+	if l.Region == "" || strings.Contains(l.Region, "-") {
+		return l.Region
+	}
+	return l.Country + "-" + l.Region
+}
+
+// equal reports whether l and o describe the same location. Like the MMDB
+// comparison, it ignores case.
+func (l Location) equal(o Location) bool {
+	return strings.EqualFold(l.Country, o.Country) &&
+		strings.EqualFold(l.regionCode(), o.regionCode()) &&
+		strings.EqualFold(l.City, o.City) &&
+		strings.EqualFold(l.PostalCode, o.PostalCode)
+}
+
+// Entry is a network and its location, as found in a geofeed row.
+type Entry struct {
+	Network  netip.Prefix
+	Location Location
+}
+
+// ChangeKind describes how an address range changed between two geofeeds.
+type ChangeKind int
+
+// Change kinds.
+const (
+	Added ChangeKind = iota
+	Removed
+	Relocated
+)
+
+// String implements the Stringer interface.
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Relocated:
+		return "relocated"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (k ChangeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// RangeChange is a contiguous address range that changed between two
+// geofeeds. Old is nil for added ranges and New is nil for removed ranges.
+type RangeChange struct {
+	Kind  ChangeKind `json:"kind"`
+	Start netip.Addr `json:"start"`
+	End   netip.Addr `json:"end"`
+	// Networks is the smallest list of networks covering Start to End.
+	Networks []netip.Prefix `json:"networks"`
+	Old      *Location      `json:"old,omitempty"`
+	New      *Location      `json:"new,omitempty"`
+}
+
+// DiffResult holds the result of comparing two geofeeds.
+type DiffResult struct {
+	// Old and New hold the validation results for the two geofeeds.
+	Old CheckResult
+	New CheckResult
+	// Changes lists the changed address ranges in address order.
+	Changes []RangeChange
+}
+
+// DiffGeofeeds compares two geofeeds at the address range level. Networks are
+// expanded to the address ranges they cover, so re-aggregating, splitting or
+// reordering rows without changing the location of any address does not
+// produce a change. Where networks within one geofeed overlap, the most
+// specific network determines the location of its addresses; for identical
+// networks, the later row wins.
+//
+// Both geofeeds must be valid. If either is not, the returned DiffResult holds
+// the validation results and the error wraps ErrInvalidGeofeed or
+// ErrEmptyGeofeed.
+func DiffGeofeeds(oldFilename, newFilename string, opts Options) (DiffResult, error) {
+	var d DiffResult
+
+	oldRanges, c, err := readRanges(oldFilename, opts)
+	d.Old = c
+	if err != nil {
+		return d, fmt.Errorf("old geofeed: %w", err)
+	}
+
+	newRanges, c, err := readRanges(newFilename, opts)
+	d.New = c
+	if err != nil {
+		return d, fmt.Errorf("new geofeed: %w", err)
+	}
+
+	d.Changes = diffRanges(oldRanges, newRanges)
+	return d, nil
+}
+
+type addrRange struct {
+	start netip.Addr
+	end   netip.Addr
+	loc   Location
+}
+
+// readRanges validates the geofeed in the same way as format-only mode and
+// returns the address ranges it maps.
+func readRanges(geofeedFilename string, opts Options) ([]addrRange, CheckResult, error) {
+	entries, c, err := readEntries(geofeedFilename, opts)
+	if err != nil {
+		return nil, c, err
+	}
+	return flatten(entries), c, nil
+}
+
+// readEntries validates the geofeed in the same way as format-only mode and
+// returns its rows.
+func readEntries(geofeedFilename string, opts Options) ([]Entry, CheckResult, error) {
+	c := NewCheckResult()
+
+	gf, err := openGeofeed(geofeedFilename, opts)
+	if err != nil {
+		return nil, c, err
+	}
+	defer gf.Close()
+
+	var (
+		entries []Entry
+		invalid InvalidGeofeedError
+	)
+	addInvalid := func(result verificationResult, row []string) {
+		rowErr := result.rowError(readPosition(gf.csv, len(row)), row)
+		c.addInvalid(rowErr)
+		invalid.add(rowErr)
+	}
+	for {
+		row, err := gf.csv.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, c, readRowError(geofeedFilename, err, opts)
+		}
+
+		c.Total++
+
+		if len(row) < expectedFieldsPerRecord {
+			addInvalid(fewerFieldsResult(row), row)
+			continue
+		}
+
+		correction := row[:expectedFieldsPerRecord]
+		for i, v := range correction {
+			correction[i] = strings.TrimSpace(v)
+		}
+
+		_, network, result := parseNetwork(correction)
+		if !result.valid {
+			addInvalid(result, row)
+			continue
+		}
+		// parseNetwork widens a single IPv6 address to a /64 for the MMDB
+		// lookup, but the row only maps that address.
+		if !strings.Contains(correction[0], "/") {
+			network = netip.PrefixFrom(network.Addr(), network.Addr().BitLen())
+		}
+		if !regionCodeFormatOK(correction[2], opts) {
+			addInvalid(invalidRegionCodeResult(correction), row)
+			continue
+		}
+
+		entries = append(entries, Entry{
+			Network: network.Masked(),
+			Location: Location{
+				Country:    correction[1],
+				Region:     correction[2],
+				City:       correction[3],
+				PostalCode: correction[4],
+			},
+		})
+	}
+
+	if c.Total == 0 && !opts.EmptyOK {
+		return nil, c, ErrEmptyGeofeed
+	}
+
+	if invalid.Invalid > 0 {
+		return nil, c, &invalid
+	}
+
+	return entries, c, nil
+}
+
+// flatten turns possibly overlapping networks into sorted, non-overlapping
+// address ranges, giving precedence to more specific networks.
+func flatten(entries []Entry) []addrRange {
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		if c := a.Network.Addr().Compare(b.Network.Addr()); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Network.Bits(), b.Network.Bits())
+	})
+
+	var (
+		ranges []addrRange
+		// stack holds the networks containing the current network, least
+		// specific first.
+		stack []addrRange
+		// cursor is the first address that has not been assigned a range
+		// yet. It is invalid once the end of an address family is reached.
+		cursor netip.Addr
+	)
+	emit := func(end netip.Addr, loc Location) {
+		if !cursor.IsValid() || end.Less(cursor) {
+			return
+		}
+		n := len(ranges)
+		if n > 0 && ranges[n-1].loc == loc && ranges[n-1].end.Next() == cursor {
+			ranges[n-1].end = end
+		} else {
+			ranges = append(ranges, addrRange{start: cursor, end: end, loc: loc})
+		}
+		cursor = end.Next()
+	}
+	pop := func() {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		emit(top.end, top.loc)
+	}
+
+	for _, e := range entries {
+		r := addrRange{
+			start: e.Network.Addr(),
+			end:   lastAddr(e.Network),
+			loc:   e.Location,
+		}
+		for len(stack) > 0 && stack[len(stack)-1].end.Less(r.start) {
+			pop()
+		}
+		if len(stack) > 0 {
+			emit(r.start.Prev(), stack[len(stack)-1].loc)
+		}
+		cursor = r.start
+		stack = append(stack, r)
+	}
+	for len(stack) > 0 {
+		pop()
+	}
+
+	return ranges
+}
+
+// diffRanges compares two sets of sorted, non-overlapping address ranges.
+func diffRanges(oldRanges, newRanges []addrRange) []RangeChange {
+	var (
+		changes []RangeChange
+		i, j    int
+		cur     netip.Addr
+	)
+	for i < len(oldRanges) || j < len(newRanges) {
+		inOld := i < len(oldRanges) && cur.IsValid() && !cur.Less(oldRanges[i].start)
+		inNew := j < len(newRanges) && cur.IsValid() && !cur.Less(newRanges[j].start)
+		if !inOld && !inNew {
+			// Skip ahead to the next address mapped by either geofeed.
+			switch {
+			case i == len(oldRanges):
+				cur = newRanges[j].start
+			case j == len(newRanges):
+				cur = oldRanges[i].start
+			default:
+				cur = minAddr(oldRanges[i].start, newRanges[j].start)
+			}
+			continue
+		}
+
+		// The segment ends where the first of the ranges involved ends or
+		// where the next range begins.
+		var end netip.Addr
+		for _, candidate := range []struct {
+			ranges []addrRange
+			idx    int
+			in     bool
+		}{
+			{oldRanges, i, inOld},
+			{newRanges, j, inNew},
+		} {
+			if candidate.idx == len(candidate.ranges) {
+				continue
+			}
+			r := candidate.ranges[candidate.idx]
+			e := r.end
+			if !candidate.in {
+				if r.start.BitLen() != cur.BitLen() {
+					continue
+				}
+				e = r.start.Prev()
+			}
+			if !end.IsValid() || e.Less(end) {
+				end = e
+			}
+		}
+
+		change := RangeChange{Start: cur, End: end}
+		changed := true
+		switch {
+		case inOld && !inNew:
+			change.Kind = Removed
+			change.Old = locationPtr(oldRanges[i].loc)
+		case !inOld && inNew:
+			change.Kind = Added
+			change.New = locationPtr(newRanges[j].loc)
+		case !oldRanges[i].loc.equal(newRanges[j].loc):
+			change.Kind = Relocated
+			change.Old = locationPtr(oldRanges[i].loc)
+			change.New = locationPtr(newRanges[j].loc)
+		default:
+			changed = false
+		}
+		if changed {
+			changes = appendChange(changes, change)
+		}
+
+		if inOld && oldRanges[i].end == end {
+			i++
+		}
+		if inNew && newRanges[j].end == end {
+			j++
+		}
+		cur = end.Next()
+	}
+
+	for i := range changes {
+		changes[i].Networks = rangePrefixes(changes[i].Start, changes[i].End)
+	}
+
+	return changes
+}
+
+// appendChange appends change, merging it with the previous change if they
+// are adjacent and otherwise identical.
+func appendChange(changes []RangeChange, change RangeChange) []RangeChange {
+	n := len(changes)
+	if n > 0 {
+		last := &changes[n-1]
+		if last.Kind == change.Kind &&
+			last.End.Next() == change.Start &&
+			equalLocationPtr(last.Old, change.Old) &&
+			equalLocationPtr(last.New, change.New) {
+			last.End = change.End
+			return changes
+		}
+	}
+	return append(changes, change)
+}
+
+func equalLocationPtr(a, b *Location) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func locationPtr(l Location) *Location {
+	return &l
+}
+
+func minAddr(a, b netip.Addr) netip.Addr {
+	if b.Less(a) {
+		return b
+	}
+	return a
+}
+
+// lastAddr returns the last address in p.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	last, _ := netip.AddrFromSlice(b)
+	return last
+}
+
+// rangePrefixes returns the smallest list of networks covering the addresses
+// from start to end, inclusive.
+func rangePrefixes(start, end netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for start.IsValid() && !end.Less(start) {
+		var p netip.Prefix
+		for bits := 0; bits <= start.BitLen(); bits++ {
+			p = netip.PrefixFrom(start, bits)
+			if p.Masked().Addr() == start && !end.Less(lastAddr(p)) {
+				break
+			}
+		}
+		prefixes = append(prefixes, p)
+		start = lastAddr(p).Next()
+	}
+	return prefixes
+}
+
+// String returns a human-readable description of the change.
+func (c RangeChange) String() string {
+	networks := make([]string, 0, len(c.Networks))
+	for _, n := range c.Networks {
+		networks = append(networks, n.String())
+	}
+	lines := []string{fmt.Sprintf("%s %s", c.Kind, strings.Join(networks, ", "))}
+	if c.Old != nil {
+		lines = append(lines, fmt.Sprintf("old: '%s'", c.Old))
+	}
+	if c.New != nil {
+		lines = append(lines, fmt.Sprintf("new: '%s'", c.New))
+	}
+	return strings.Join(lines, "\n\t")
+}
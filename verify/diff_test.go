@@ -0,0 +1,173 @@
+package verify
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffGeofeeds(t *testing.T) {
+	d, err := DiffGeofeeds(
+		"test_data/geofeed-diff-old.csv",
+		"test_data/geofeed-diff-new.csv",
+		Options{},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 5, d.Old.Total)
+	assert.Equal(t, 7, d.New.Total)
+
+	expected := []RangeChange{
+		{
+			Kind:     Added,
+			Start:    netip.MustParseAddr("100.64.0.0"),
+			End:      netip.MustParseAddr("100.64.0.255"),
+			Networks: []netip.Prefix{netip.MustParsePrefix("100.64.0.0/24")},
+			New: &Location{
+				Country: "US",
+				Region:  "US-CA",
+				City:    "San Jose",
+			},
+		},
+		{
+			Kind:     Relocated,
+			Start:    netip.MustParseAddr("192.0.2.64"),
+			End:      netip.MustParseAddr("192.0.2.127"),
+			Networks: []netip.Prefix{netip.MustParsePrefix("192.0.2.64/26")},
+			Old: &Location{
+				Country: "US",
+				Region:  "US-NJ",
+				City:    "Parsippany",
+			},
+			New: &Location{
+				Country: "US",
+				Region:  "US-NJ",
+				City:    "Newark",
+			},
+		},
+		{
+			Kind:     Relocated,
+			Start:    netip.MustParseAddr("198.51.100.128"),
+			End:      netip.MustParseAddr("198.51.100.255"),
+			Networks: []netip.Prefix{netip.MustParsePrefix("198.51.100.128/25")},
+			Old: &Location{
+				Country: "US",
+				Region:  "US-NY",
+				City:    "New York",
+			},
+			New: &Location{
+				Country: "US",
+				Region:  "US-NY",
+				City:    "Brooklyn",
+			},
+		},
+		{
+			Kind:     Removed,
+			Start:    netip.MustParseAddr("2001:db8:8000::"),
+			End:      netip.MustParseAddr("2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"),
+			Networks: []netip.Prefix{netip.MustParsePrefix("2001:db8:8000::/33")},
+			Old: &Location{
+				Country: "DE",
+				Region:  "DE-BE",
+				City:    "Berlin",
+			},
+		},
+	}
+	assert.Equal(t, expected, d.Changes)
+}
+
+func TestDiffGeofeeds_Identical(t *testing.T) {
+	d, err := DiffGeofeeds(
+		"test_data/geofeed-valid.csv",
+		"test_data/geofeed-valid-utf8-bom.csv",
+		Options{},
+	)
+	require.NoError(t, err)
+	assert.Empty(t, d.Changes)
+}
+
+func TestDiffGeofeeds_SingleAddress(t *testing.T) {
+	dir := t.TempDir()
+	oldGF := filepath.Join(dir, "old.csv")
+	newGF := filepath.Join(dir, "new.csv")
+	require.NoError(t, os.WriteFile(oldGF, []byte("2001:db8::/64,US,US-CA,A,\n"), 0o600))
+	require.NoError(t, os.WriteFile(
+		newGF,
+		[]byte("2001:db8::/64,US,US-CA,A,\n2001:db8::1,DE,DE-BE,Berlin,\n"),
+		0o600,
+	))
+
+	d, err := DiffGeofeeds(oldGF, newGF, Options{})
+	require.NoError(t, err)
+	require.Len(t, d.Changes, 1)
+	assert.Equal(t, Relocated, d.Changes[0].Kind)
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), d.Changes[0].Start)
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), d.Changes[0].End)
+	assert.Equal(
+		t,
+		[]netip.Prefix{netip.MustParsePrefix("2001:db8::1/128")},
+		d.Changes[0].Networks,
+	)
+}
+
+func TestDiffGeofeeds_Invalid(t *testing.T) {
+	d, err := DiffGeofeeds(
+		"test_data/geofeed-valid.csv",
+		"test_data/geofeed-invalid-network.csv",
+		Options{},
+	)
+	require.ErrorIs(t, err, ErrInvalidGeofeed)
+	assert.Equal(t, 0, d.Old.Invalid)
+	assert.Equal(t, 1, d.New.Invalid)
+	assert.Contains(t, d.New.SampleInvalidRows, UnableToParseNetwork)
+
+	var rowErr *RowError
+	require.ErrorAs(t, err, &rowErr)
+	assert.Equal(t, UnableToParseNetwork, rowErr.Invalidity)
+	assert.Equal(t, "2a02:/29", rowErr.Value)
+}
+
+func TestRangePrefixes(t *testing.T) {
+	tests := []struct {
+		start    string
+		end      string
+		expected []string
+	}{
+		{
+			start:    "10.0.0.0",
+			end:      "10.0.0.255",
+			expected: []string{"10.0.0.0/24"},
+		},
+		{
+			start:    "10.0.0.1",
+			end:      "10.0.0.6",
+			expected: []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"},
+		},
+		{
+			start:    "0.0.0.0",
+			end:      "255.255.255.255",
+			expected: []string{"0.0.0.0/0"},
+		},
+		{
+			start:    "2001:db8::",
+			end:      "2001:db8::1:ffff",
+			expected: []string{"2001:db8::/111"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.start+"-"+test.end, func(t *testing.T) {
+			var prefixes []string
+			for _, p := range rangePrefixes(
+				netip.MustParseAddr(test.start),
+				netip.MustParseAddr(test.end),
+			) {
+				prefixes = append(prefixes, p.String())
+			}
+			assert.Equal(t, test.expected, prefixes)
+		})
+	}
+}
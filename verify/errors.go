@@ -1,6 +1,9 @@
 package verify
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	// ErrNotUTF8 indicates a file encoding that is not valid UTF-8 (with
@@ -14,6 +17,9 @@ var (
 	ErrInvalidGeofeed = errors.New("geofeed does not comply with the RFC 8805 standards")
 	// ErrEmptyGeofeed indicates a Geofeed with no records.
 	ErrEmptyGeofeed = errors.New("geofeed is empty")
+	// ErrUnsupportedDatabase indicates an MMDB whose database type cannot be
+	// used for its purpose, e.g., an ASN database passed as the City MMDB.
+	ErrUnsupportedDatabase = errors.New("unsupported database type")
 )
 
 // RowInvalidity represents type of row invalidity.
@@ -48,3 +54,78 @@ func (ri RowInvalidity) String() string {
 		return "UnknownInvalidityType"
 	}
 }
+
+// RowError describes an invalid geofeed row.
+type RowError struct {
+	// Line is the line number of the field at fault or, if Field is -1, of
+	// the start of the row. Comments and blank lines are counted.
+	Line int
+	// Column is the 1-based byte index of the field at fault within its
+	// line, or 0 if Field is -1.
+	Column int
+	// Field is the index of the field (CSV column) at fault, starting at 0
+	// for the network, or -1 if the error does not concern a single field,
+	// e.g., if the row has fewer fields than expected.
+	Field int
+	// Invalidity is the type of invalidity.
+	Invalidity RowInvalidity
+	// Value is the value of the field at fault, if any.
+	Value string
+	// Row holds the fields of the row.
+	Row []string
+	// Reason describes why the row is invalid.
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *RowError) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Reason)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// MaxInvalidRowErrors is the maximum number of row errors kept in an
+// InvalidGeofeedError, so that memory use does not grow with the number of
+// invalid rows.
+const MaxInvalidRowErrors = 1000
+
+// InvalidGeofeedError is returned for geofeeds with invalid rows. It wraps
+// ErrInvalidGeofeed as well as a *RowError for each of the first
+// MaxInvalidRowErrors invalid rows, so both errors.Is(err, ErrInvalidGeofeed)
+// and errors.As may be used with it.
+type InvalidGeofeedError struct {
+	// Rows holds the errors for the first MaxInvalidRowErrors invalid rows, in
+	// geofeed order.
+	Rows []*RowError
+	// Invalid is the number of invalid rows, including those not in Rows.
+	Invalid int
+}
+
+// add records an invalid row, keeping its error if fewer than
+// MaxInvalidRowErrors are kept.
+func (e *InvalidGeofeedError) add(rowErr *RowError) {
+	e.Invalid++
+	if len(e.Rows) < MaxInvalidRowErrors {
+		e.Rows = append(e.Rows, rowErr)
+	}
+}
+
+// Error implements the error interface.
+func (e *InvalidGeofeedError) Error() string {
+	invalid := max(e.Invalid, len(e.Rows))
+	if invalid == 1 {
+		return fmt.Sprintf("%s: 1 invalid row", ErrInvalidGeofeed)
+	}
+	return fmt.Sprintf("%s: %d invalid rows", ErrInvalidGeofeed, invalid)
+}
+
+// Unwrap returns ErrInvalidGeofeed followed by the row errors.
+func (e *InvalidGeofeedError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Rows)+1)
+	errs = append(errs, ErrInvalidGeofeed)
+	for _, rowErr := range e.Rows {
+		errs = append(errs, rowErr)
+	}
+	return errs
+}
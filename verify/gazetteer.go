@@ -0,0 +1,147 @@
+package verify
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Coordinates are a latitude and longitude in degrees.
+type Coordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// earthRadius is the mean radius of the Earth in kilometers.
+const earthRadius = 6371.0088
+
+// Distance returns the great-circle distance between c and o in kilometers.
+func (c Coordinates) Distance(o Coordinates) float64 {
+	lat1 := c.Latitude * math.Pi / 180
+	lat2 := o.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (o.Longitude - c.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+type gazetteerKey struct {
+	country string
+	region  string
+	city    string
+}
+
+// Gazetteer maps city names to their coordinates. It is used to compute the
+// distance between the city suggested by a geofeed row and the location in the
+// MMDB. City names are matched ignoring case, accents and punctuation.
+type Gazetteer struct {
+	// cities holds the cities by country, region and name. The region is
+	// empty for cities added without one.
+	cities map[gazetteerKey]Coordinates
+	// byName holds the cities by country and name, ignoring the region.
+	// Names that are ambiguous within a country map to nil.
+	byName map[gazetteerKey]*Coordinates
+}
+
+// NewGazetteer returns an empty Gazetteer.
+func NewGazetteer() *Gazetteer {
+	return &Gazetteer{
+		cities: map[gazetteerKey]Coordinates{},
+		byName: map[gazetteerKey]*Coordinates{},
+	}
+}
+
+// Add adds a city. The region is an ISO 3166-2 code, with or without the
+// country code prefix, and may be empty.
+func (g *Gazetteer) Add(country, region, city string, c Coordinates) {
+	key := newGazetteerKey(country, region, city)
+	g.cities[key] = c
+
+	key.region = ""
+	if existing, ok := g.byName[key]; ok {
+		if existing != nil && *existing != c {
+			g.byName[key] = nil
+		}
+		return
+	}
+	g.byName[key] = &c
+}
+
+// Lookup returns the coordinates of a city. If the region is empty, the city
+// is only found if its name is unambiguous within the country.
+func (g *Gazetteer) Lookup(country, region, city string) (Coordinates, bool) {
+	key := newGazetteerKey(country, region, city)
+	if key.city == "" {
+		return Coordinates{}, false
+	}
+	if key.region != "" {
+		if c, ok := g.cities[key]; ok {
+			return c, true
+		}
+		key.region = ""
+		c, ok := g.cities[key]
+		return c, ok
+	}
+	if c := g.byName[key]; c != nil {
+		return *c, true
+	}
+	return Coordinates{}, false
+}
+
+func newGazetteerKey(country, region, city string) gazetteerKey {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	region = strings.ToUpper(strings.TrimSpace(region))
+	if region != "" && !strings.Contains(region, "-") {
+		region = country + "-" + region
+	}
+	return gazetteerKey{
+		country: country,
+		region:  region,
+		city:    strings.Join(cityNameWords(city), " "),
+	}
+}
+
+// ReadGazetteer reads a gazetteer in CSV format with the fields country,
+// region, city, latitude and longitude, e.g.,
+// "US,US-WA,Milton,47.2481,-122.3132". The region may be empty. Comments
+// starting with '#' are ignored.
+func ReadGazetteer(r io.Reader) (*Gazetteer, error) {
+	csvReader := csv.NewReader(newUTF8Reader(r))
+	csvReader.Comment = '#'
+	csvReader.FieldsPerRecord = 5
+	csvReader.TrimLeadingSpace = true
+
+	g := NewGazetteer()
+	for {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			return g, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := csvReader.FieldPos(0)
+		var c Coordinates
+		c.Latitude, err = strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+		if err != nil || !validCoordinate(c.Latitude, 90) {
+			return nil, fmt.Errorf("line %d: invalid latitude %q", line, record[3])
+		}
+		c.Longitude, err = strconv.ParseFloat(strings.TrimSpace(record[4]), 64)
+		if err != nil || !validCoordinate(c.Longitude, 180) {
+			return nil, fmt.Errorf("line %d: invalid longitude %q", line, record[4])
+		}
+		g.Add(record[0], record[1], record[2], c)
+	}
+}
+
+// validCoordinate reports whether v is a number within [-limit, limit].
+func validCoordinate(v, limit float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0) && math.Abs(v) <= limit
+}
@@ -0,0 +1,75 @@
+package verify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoordinatesDistance(t *testing.T) {
+	london := Coordinates{Latitude: 51.5074, Longitude: -0.1278}
+	paris := Coordinates{Latitude: 48.8566, Longitude: 2.3522}
+	assert.InDelta(t, 343.5, london.Distance(paris), 0.5)
+	assert.InDelta(t, london.Distance(paris), paris.Distance(london), 1e-9)
+	assert.Zero(t, london.Distance(london))
+
+	// Antipodal points are half the circumference of the Earth apart.
+	north := Coordinates{Latitude: 90}
+	south := Coordinates{Latitude: -90}
+	assert.InDelta(t, 20015.1, north.Distance(south), 0.5)
+}
+
+func TestGazetteer(t *testing.T) {
+	g, err := ReadGazetteer(strings.NewReader(
+		"# country,region,city,latitude,longitude\n" +
+			"US,US-IL,Springfield,39.7817,-89.6501\n" +
+			"US,MO,Springfield,37.2090,-93.2923\n" +
+			"US,,Seattle,47.6062,-122.3321\n" +
+			"BR,BR-SP,São Paulo,-23.5505,-46.6333\n",
+	))
+	require.NoError(t, err)
+
+	tests := []struct {
+		country, region, city string
+		latitude              float64
+		found                 bool
+	}{
+		{"US", "US-IL", "Springfield", 39.7817, true},
+		{"us", "il", "springfield", 39.7817, true},
+		{"US", "US-MO", "Springfield", 37.2090, true},
+		// Ambiguous without a region.
+		{"US", "", "Springfield", 0, false},
+		{"US", "US-OR", "Springfield", 0, false},
+		{"US", "US-WA", "Seattle", 47.6062, true},
+		{"US", "", "Seattle", 47.6062, true},
+		{"CA", "", "Seattle", 0, false},
+		{"BR", "BR-SP", "Sao Paulo", -23.5505, true},
+		{"US", "", "", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.country+" "+test.region+" "+test.city, func(t *testing.T) {
+			c, ok := g.Lookup(test.country, test.region, test.city)
+			assert.Equal(t, test.found, ok)
+			assert.InDelta(t, test.latitude, c.Latitude, 1e-9)
+		})
+	}
+}
+
+func TestReadGazetteer_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"US,US-WA,Seattle,north,-122.3321\n":    `line 1: invalid latitude "north"`,
+		"US,US-WA,Seattle,47.6062,-222.3321\n":  `line 1: invalid longitude "-222.3321"`,
+		"US,US-WA,Seattle,NaN,-122.3321\n":      `line 1: invalid latitude "NaN"`,
+		"US,US-WA,Seattle,47.6062,nan\n":        `line 1: invalid longitude "nan"`,
+		"US,US-WA,Seattle,+Inf,-122.3321\n":     `line 1: invalid latitude "+Inf"`,
+		"US,US-WA,Seattle,47.6062\n":            "wrong number of fields",
+		"US,US-WA,Seattle,47.6,-122.3\nUS,WA\n": "wrong number of fields",
+	}
+	for input, message := range tests {
+		_, err := ReadGazetteer(strings.NewReader(input))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), message)
+	}
+}
@@ -0,0 +1,124 @@
+package verify
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// cityRecord holds the fields of a City MMDB record that correspond to
+// geofeed fields.
+type cityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+	Location struct {
+		Latitude       *float64 `maxminddb:"latitude"`
+		Longitude      *float64 `maxminddb:"longitude"`
+		AccuracyRadius uint16   `maxminddb:"accuracy_radius"`
+	} `maxminddb:"location"`
+}
+
+// location returns the geofeed location for the record, using the most
+// specific subdivision and the English city name.
+func (r cityRecord) location() Location {
+	loc := Location{
+		Country:    r.Country.ISOCode,
+		City:       r.City.Names["en"],
+		PostalCode: r.Postal.Code,
+	}
+	if n := len(r.Subdivisions); n > 0 && r.Subdivisions[n-1].ISOCode != "" {
+		loc.Region = loc.Country + "-" + r.Subdivisions[n-1].ISOCode
+	}
+	return loc
+}
+
+// GenerateGeofeed returns geofeed entries for the given prefixes based on the
+// data in the City MMDB at mmdbFilename. A prefix is split where the MMDB has
+// different locations for parts of it, and adjacent networks with the same
+// location are aggregated. Parts of a prefix that have no data in the MMDB
+// are omitted. If the type of the MMDB shows it has no location data, e.g.,
+// for ISP databases, the error wraps ErrUnsupportedDatabase.
+func GenerateGeofeed(
+	prefixes []netip.Prefix,
+	mmdbFilename string,
+	opts Options,
+) ([]Entry, error) {
+	db, err := openLocationMMDB(mmdbFilename, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var entries []Entry
+	for _, prefix := range prefixes {
+		prefix = prefix.Masked()
+
+		var ranges []addrRange
+		for result := range db.NetworksWithin(prefix) {
+			var record cityRecord
+			if err := result.Decode(&record); err != nil {
+				return nil, fmt.Errorf("unable to read record for %s: %w", prefix, err)
+			}
+
+			// If the prefix is within a network in the MMDB, the containing
+			// network is returned.
+			network := result.Prefix()
+			if network.Bits() < prefix.Bits() {
+				network = prefix
+			}
+
+			r := addrRange{
+				start: network.Addr(),
+				end:   lastAddr(network),
+				loc:   record.location(),
+			}
+			n := len(ranges)
+			if n > 0 && ranges[n-1].loc == r.loc && ranges[n-1].end.Next() == r.start {
+				ranges[n-1].end = r.end
+				continue
+			}
+			ranges = append(ranges, r)
+		}
+
+		for _, r := range ranges {
+			for _, network := range rangePrefixes(r.start, r.end) {
+				entries = append(entries, Entry{Network: network, Location: r.loc})
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// WriteGeofeed writes entries to w as RFC 8805 rows.
+func WriteGeofeed(w io.Writer, entries []Entry) error {
+	csvWriter := csv.NewWriter(w)
+	for _, e := range entries {
+		err := csvWriter.Write([]string{
+			e.Network.String(),
+			e.Location.Country,
+			e.Location.Region,
+			e.Location.City,
+			e.Location.PostalCode,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to write geofeed row: %w", err)
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("unable to write geofeed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package verify
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateGeofeed(t *testing.T) {
+	entries, err := GenerateGeofeed(
+		[]netip.Prefix{
+			netip.MustParsePrefix("81.2.69.128/25"),
+			netip.MustParsePrefix("202.196.224.5/32"),
+			netip.MustParsePrefix("2.125.160.216/29"),
+			netip.MustParsePrefix("192.0.2.0/24"),
+		},
+		"test_data/GeoIP2-City-Test.mmdb",
+		Options{},
+	)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteGeofeed(&buf, entries))
+	assert.Equal(
+		t,
+		`81.2.69.142/31,GB,GB-ENG,London,
+81.2.69.144/28,GB,GB-ENG,London,
+81.2.69.160/27,GB,GB-ENG,London,
+81.2.69.192/28,GB,GB-ENG,London,
+202.196.224.5/32,PH,,,34021
+2.125.160.216/29,GB,GB-WBK,Boxford,OX1
+`,
+		buf.String(),
+	)
+}
+
+func TestGenerateGeofeed_UnsupportedDatabase(t *testing.T) {
+	isp := writeTestMMDB(
+		t,
+		mmdbwriter.Options{DatabaseType: "GeoIP2-ISP"},
+		map[string]mmdbtype.Map{
+			"81.2.69.128/25": {"isp": mmdbtype.String("Example ISP")},
+		},
+	)
+
+	_, err := GenerateGeofeed(
+		[]netip.Prefix{netip.MustParsePrefix("81.2.69.128/25")},
+		isp,
+		Options{},
+	)
+	require.ErrorIs(t, err, ErrUnsupportedDatabase)
+	assert.EqualError(t, err, "unsupported database type for the MMDB "+isp+": GeoIP2-ISP")
+}
+
+func TestGenerateGeofeed_RoundTrip(t *testing.T) {
+	entries, err := GenerateGeofeed(
+		[]netip.Prefix{netip.MustParsePrefix("216.160.83.56/29")},
+		"test_data/GeoIP2-City-Test.mmdb",
+		Options{},
+	)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteGeofeed(&buf, entries))
+
+	gf := filepath.Join(t.TempDir(), "geofeed.csv")
+	require.NoError(t, os.WriteFile(gf, buf.Bytes(), 0o600))
+
+	c, dl, _, err := ProcessGeofeed(gf, "test_data/GeoIP2-City-Test.mmdb", "", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.Total)
+	assert.Empty(t, dl, "a generated geofeed should not differ from its MMDB")
+}
@@ -0,0 +1,56 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// DatabaseInfo describes an MMDB used in a comparison, as found in its
+// metadata. It makes it possible to tell which build of a database the
+// results are based on.
+type DatabaseInfo struct {
+	// DatabaseType is the type of the database, e.g., "GeoIP2-City".
+	DatabaseType string `json:"database_type"`
+	// BuildEpoch is the time at which the database was built, in seconds
+	// since the Unix epoch.
+	BuildEpoch uint `json:"build_epoch"`
+	// IPVersion is 4 for databases with IPv4 addresses only and 6 for
+	// databases with both IPv4 and IPv6 addresses.
+	IPVersion uint `json:"ip_version"`
+	// Languages are the locales of the localized names in the database.
+	Languages []string `json:"languages"`
+}
+
+func newDatabaseInfo(m maxminddb.Metadata) *DatabaseInfo {
+	return &DatabaseInfo{
+		DatabaseType: m.DatabaseType,
+		BuildEpoch:   m.BuildEpoch,
+		IPVersion:    m.IPVersion,
+		Languages:    m.Languages,
+	}
+}
+
+// BuildTime returns the time at which the database was built.
+func (d *DatabaseInfo) BuildTime() time.Time {
+	return time.Unix(int64(d.BuildEpoch), 0).UTC() //nolint:gosec // epochs fit in int64
+}
+
+// Age returns how long before now the database was built.
+func (d *DatabaseInfo) Age(now time.Time) time.Duration {
+	return now.Sub(d.BuildTime())
+}
+
+// String returns a one-line description of the database, e.g.,
+// "GeoIP2-City built 2026-10-13 15:04:05 UTC, IPv6, languages: de, en".
+func (d *DatabaseInfo) String() string {
+	return fmt.Sprintf(
+		"%s built %s, IPv%d, languages: %s",
+		d.DatabaseType,
+		d.BuildTime().Format(time.DateTime+" MST"),
+		d.IPVersion,
+		strings.Join(d.Languages, ", "),
+	)
+}
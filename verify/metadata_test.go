@@ -0,0 +1,39 @@
+package verify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabaseInfo(t *testing.T) {
+	c, _, err := StreamGeofeed(
+		t.Context(),
+		"test_data/geofeed-valid.csv",
+		cityTestDatabase,
+		"",
+		Options{},
+		func(RowResult) error { return nil },
+	)
+	require.NoError(t, err)
+	assert.Equal(t, cityTestDatabaseInfo, c.Database)
+	assert.Nil(t, c.ISPDatabase)
+
+	info := c.Database
+	assert.Equal(t, time.Date(2020, 9, 23, 18, 39, 12, 0, time.UTC), info.BuildTime())
+	assert.Equal(t, 48*time.Hour, info.Age(time.Date(2020, 9, 25, 18, 39, 12, 0, time.UTC)))
+	assert.Equal(
+		t,
+		"GeoIP2-City built 2020-09-23 18:39:12 UTC, IPv6, languages: en, zh",
+		info.String(),
+	)
+}
+
+func TestDatabaseInfo_FormatOnly(t *testing.T) {
+	c, _, _, err := ProcessGeofeed("test_data/geofeed-valid.csv", "", "", Options{})
+	require.NoError(t, err)
+	assert.Nil(t, c.Database)
+	assert.Nil(t, c.ISPDatabase)
+}
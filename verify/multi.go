@@ -0,0 +1,145 @@
+package verify
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoMMDB indicates that no MMDB was provided to compare a geofeed against.
+var ErrNoMMDB = errors.New("no MMDB provided")
+
+// MultiRowResult is the result of verifying a geofeed row against several
+// MMDBs.
+type MultiRowResult struct {
+	// Line is the line of the geofeed on which the row starts.
+	Line int
+	// Row holds the fields of the row.
+	Row []string
+	// Err describes why the row is invalid. It is nil for valid rows. A row
+	// is invalid if it is invalid for any of the MMDBs.
+	Err *RowError
+	// Comparisons holds the comparison of a valid row against each MMDB, in
+	// the order of the MMDBs.
+	Comparisons []*Comparison
+}
+
+// Differs reports whether the row differs from the i-th MMDB.
+func (r MultiRowResult) Differs(i int) bool {
+	return r.Err == nil && len(r.Comparisons[i].Differences) > 0
+}
+
+// DatabaseResult summarizes the comparison of a geofeed against one of
+// several MMDBs.
+type DatabaseResult struct {
+	Database *DatabaseInfo `json:"database"`
+	// Differences is the number of rows that differ from the MMDB.
+	Differences int `json:"differences"`
+	// Adopted is the number of rows that differ from the previous MMDB but
+	// not from this one, i.e., the corrections picked up since the previous
+	// MMDB. It is 0 for the first MMDB.
+	Adopted int `json:"adopted"`
+	// Reverted is the number of rows that do not differ from the previous
+	// MMDB but differ from this one. It is 0 for the first MMDB.
+	Reverted int `json:"reverted"`
+}
+
+// MultiCheckResult holds the results of comparing a geofeed against several
+// MMDBs.
+type MultiCheckResult struct {
+	Total             int
+	Invalid           int
+	SampleInvalidRows map[RowInvalidity]string
+	// Databases holds the results for each MMDB, in the order of the MMDBs.
+	Databases []DatabaseResult
+	// ISPDatabase describes the ISP or ASN MMDB, if one was used.
+	ISPDatabase *DatabaseInfo
+}
+
+// CompareGeofeed is like StreamGeofeed, but compares each row of the geofeed
+// against each of the City or Country MMDBs at mmdbFilenames, e.g., several
+// builds of the same database, and calls handle with the comparisons. The
+// MMDBs are compared in the given order, so that the corrections picked up
+// between consecutive MMDBs are counted in the DatabaseResult of the later
+// one; list older builds first. If ispFilename is not empty, the AS data in
+// each comparison is taken from that ISP or ASN MMDB.
+//
+// If mmdbFilenames is empty, ErrNoMMDB is returned. Otherwise, the errors are
+// those of StreamGeofeed.
+func CompareGeofeed(
+	ctx context.Context,
+	geofeedFilename string,
+	mmdbFilenames []string,
+	ispFilename string,
+	opts Options,
+	handle func(MultiRowResult) error,
+) (MultiCheckResult, error) {
+	mc := MultiCheckResult{SampleInvalidRows: map[RowInvalidity]string{}}
+	if len(mmdbFilenames) == 0 {
+		return mc, ErrNoMMDB
+	}
+
+	gf, err := openGeofeed(geofeedFilename, opts)
+	if err != nil {
+		return mc, err
+	}
+	defer gf.Close()
+
+	cities := newCityMatcher(opts)
+	verifiers := make([]*verifier, 0, len(mmdbFilenames))
+	for _, filename := range mmdbFilenames {
+		db, err := openLocationMMDB(filename, opts)
+		if err != nil {
+			return mc, err
+		}
+		defer db.Close()
+		verifiers = append(verifiers, &verifier{
+			db:     db,
+			opts:   opts,
+			cities: cities,
+			fields: databaseFields(db.Metadata.DatabaseType),
+		})
+		mc.Databases = append(mc.Databases, DatabaseResult{
+			Database: newDatabaseInfo(db.Metadata),
+		})
+	}
+	if ispFilename != "" {
+		ispdb, err := openNetworkMMDB(ispFilename, opts)
+		if err != nil {
+			return mc, err
+		}
+		defer ispdb.Close()
+		for _, v := range verifiers {
+			v.ispdb = ispdb
+		}
+		mc.ISPDatabase = newDatabaseInfo(ispdb.Metadata)
+	}
+
+	c, err := streamRows(ctx, gf, geofeedFilename, verifiers, opts, func(vr verifiedRow) error {
+		r := MultiRowResult{
+			Line:        vr.line,
+			Row:         vr.row,
+			Err:         vr.err,
+			Comparisons: vr.comparisons,
+		}
+		for i := range mc.Databases {
+			d := &mc.Databases[i]
+			if r.Differs(i) {
+				d.Differences++
+			}
+			if i == 0 {
+				continue
+			}
+			switch {
+			case r.Differs(i-1) && !r.Differs(i):
+				d.Adopted++
+			case !r.Differs(i-1) && r.Differs(i):
+				d.Reverted++
+			}
+		}
+		return handle(r)
+	})
+	mc.Total = c.Total
+	mc.Invalid = c.Invalid
+	mc.SampleInvalidRows = c.SampleInvalidRows
+	return mc, err
+}
@@ -0,0 +1,85 @@
+package verify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareGeofeed(t *testing.T) {
+	compiled := writeMatchingTestMMDB(t)
+
+	var results []MultiRowResult
+	mc, err := CompareGeofeed(
+		t.Context(),
+		"test_data/geofeed-valid.csv",
+		[]string{cityTestDatabase, compiled, cityTestDatabase},
+		"",
+		Options{},
+		func(r MultiRowResult) error {
+			results = append(results, r)
+			return nil
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 3, mc.Total)
+	assert.Zero(t, mc.Invalid)
+	assert.Nil(t, mc.ISPDatabase)
+
+	require.Len(t, mc.Databases, 3)
+	assert.Equal(t, cityTestDatabaseInfo, mc.Databases[0].Database)
+	assert.Equal(
+		t,
+		[]DatabaseResult{
+			{Database: mc.Databases[0].Database, Differences: 2},
+			{Database: mc.Databases[1].Database, Differences: 0, Adopted: 2},
+			{Database: mc.Databases[2].Database, Differences: 2, Reverted: 2},
+		},
+		mc.Databases,
+	)
+
+	require.Len(t, results, 3)
+	assert.Equal(t, 1, results[0].Line)
+	require.Len(t, results[0].Comparisons, 3)
+	assert.True(t, results[0].Differs(0))
+	assert.False(t, results[0].Differs(1))
+	assert.Equal(t, "AZ", results[0].Comparisons[0].Current.Country)
+	assert.Equal(t, "US", results[0].Comparisons[1].Current.Country)
+	assert.False(t, results[2].Differs(0))
+}
+
+func TestCompareGeofeed_Invalid(t *testing.T) {
+	var results []MultiRowResult
+	mc, err := CompareGeofeed(
+		t.Context(),
+		"test_data/geofeed-invalid-comments.csv",
+		[]string{cityTestDatabase, cityTestDatabase},
+		"",
+		Options{},
+		func(r MultiRowResult) error {
+			results = append(results, r)
+			return nil
+		},
+	)
+	require.ErrorIs(t, err, ErrInvalidGeofeed)
+	assert.Equal(t, 4, mc.Total)
+	assert.Equal(t, 3, mc.Invalid)
+	require.Len(t, results, 4)
+	require.NotNil(t, results[1].Err)
+	assert.Nil(t, results[1].Comparisons)
+	assert.False(t, results[1].Differs(0))
+	assert.Equal(t, 1, mc.Databases[1].Differences)
+}
+
+func TestCompareGeofeed_NoMMDB(t *testing.T) {
+	_, err := CompareGeofeed(
+		t.Context(),
+		"test_data/geofeed-valid.csv",
+		nil,
+		"",
+		Options{},
+		func(MultiRowResult) error { return nil },
+	)
+	require.ErrorIs(t, err, ErrNoMMDB)
+}
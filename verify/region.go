@@ -0,0 +1,81 @@
+package verify
+
+import "strings"
+
+// RegionMatch describes how the region in a geofeed row matches the
+// subdivisions in the MMDB.
+type RegionMatch int
+
+// Region match types.
+const (
+	// RegionMismatch indicates a region that matches none of the
+	// subdivisions.
+	RegionMismatch RegionMatch = iota
+	// RegionExact indicates a region that matches the most specific
+	// subdivision, ignoring case.
+	RegionExact
+	// RegionParent indicates a region that matches a less specific
+	// subdivision, e.g., GB-ENG for a network in GB-WBK, which is in
+	// England.
+	RegionParent
+)
+
+// String implements the Stringer interface.
+func (m RegionMatch) String() string {
+	switch m {
+	case RegionMismatch:
+		return "mismatch"
+	case RegionExact:
+		return "exact"
+	case RegionParent:
+		return "parent"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m RegionMatch) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// subdivisionCodes returns the ISO codes of the subdivisions of the record,
+// from the least to the most specific one, prefixed with the country code if
+// prefixed is true.
+func (r cityRecord) subdivisionCodes(prefixed bool) []string {
+	codes := make([]string, 0, len(r.Subdivisions))
+	for _, s := range r.Subdivisions {
+		if s.ISOCode == "" {
+			continue
+		}
+		if prefixed {
+			codes = append(codes, r.Country.ISOCode+"-"+s.ISOCode)
+		} else {
+			codes = append(codes, s.ISOCode)
+		}
+	}
+	return codes
+}
+
+// matchRegion returns how the suggested region matches the subdivision codes,
+// which are ordered from the least to the most specific one, along with the
+// 1-based level of the matching subdivision. The level is 0 if no subdivision
+// matches.
+func matchRegion(suggested string, codes []string) (RegionMatch, int) {
+	if suggested == "" {
+		if len(codes) == 0 {
+			return RegionExact, 0
+		}
+		return RegionMismatch, 0
+	}
+	for i := len(codes) - 1; i >= 0; i-- {
+		if !strings.EqualFold(suggested, codes[i]) {
+			continue
+		}
+		if i == len(codes)-1 {
+			return RegionExact, i + 1
+		}
+		return RegionParent, i + 1
+	}
+	return RegionMismatch, 0
+}
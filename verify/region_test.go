@@ -0,0 +1,32 @@
+package verify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchRegion(t *testing.T) {
+	tests := []struct {
+		suggested string
+		codes     []string
+		match     RegionMatch
+		level     int
+	}{
+		{"GB-WBK", []string{"GB-ENG", "GB-WBK"}, RegionExact, 2},
+		{"gb-wbk", []string{"GB-ENG", "GB-WBK"}, RegionExact, 2},
+		{"GB-ENG", []string{"GB-ENG", "GB-WBK"}, RegionParent, 1},
+		{"GB-SCT", []string{"GB-ENG", "GB-WBK"}, RegionMismatch, 0},
+		{"US-WA", []string{"US-WA"}, RegionExact, 1},
+		{"", []string{"US-WA"}, RegionMismatch, 0},
+		{"", nil, RegionExact, 0},
+		{"PH-00", nil, RegionMismatch, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.suggested, func(t *testing.T) {
+			match, level := matchRegion(test.suggested, test.codes)
+			assert.Equal(t, test.match, match)
+			assert.Equal(t, test.level, level)
+		})
+	}
+}
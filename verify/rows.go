@@ -0,0 +1,172 @@
+package verify
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+)
+
+// rowBatchSize is the number of rows handed to a worker at once when rows are
+// verified concurrently. Batching keeps the synchronization overhead small
+// compared to the MMDB lookups.
+const rowBatchSize = 128
+
+// fieldPosition is the position of the start of a field in a geofeed.
+type fieldPosition struct {
+	// line is the 1-based line number.
+	line int
+	// column is the 1-based byte index within the line.
+	column int
+}
+
+// rowPosition describes where in a geofeed a row was read from.
+type rowPosition struct {
+	// fields holds the position of each field of the row.
+	fields []fieldPosition
+	// offset is the input offset after the row.
+	offset int64
+}
+
+// line returns the line on which the row starts.
+func (p rowPosition) line() int {
+	if len(p.fields) == 0 {
+		return 0
+	}
+	return p.fields[0].line
+}
+
+// readPosition returns the position of the row with n fields that was last
+// read by csvReader.
+func readPosition(csvReader *csv.Reader, n int) rowPosition {
+	p := rowPosition{
+		fields: make([]fieldPosition, n),
+		offset: csvReader.InputOffset(),
+	}
+	for i := range p.fields {
+		p.fields[i].line, p.fields[i].column = csvReader.FieldPos(i)
+	}
+	return p
+}
+
+type rowBatch[T any] struct {
+	rows      [][]string
+	positions []rowPosition
+	outcomes  []T
+	// err is the error that stopped reading after the rows in the batch.
+	err  error
+	done chan struct{}
+}
+
+// processRows reads all rows from csvReader and calls verifyRow on each of
+// them, using up to concurrency goroutines. Each row passed to verifyRow is a
+// copy that it may keep. handle is called on the calling goroutine with the
+// outcome of each row, in the order the rows were read, along with the
+// position of the row. processRows returns the first error from reading a
+// row or from handle, or ctx's error if it was canceled.
+func processRows[T any](
+	ctx context.Context,
+	csvReader *csv.Reader,
+	concurrency int,
+	verifyRow func(row []string) T,
+	handle func(outcome T, pos rowPosition) error,
+) error {
+	if concurrency < 2 {
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			row, err := csvReader.Read()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			pos := readPosition(csvReader, len(row))
+			// The reader reuses the row slice.
+			err = handle(verifyRow(slices.Clone(row)), pos)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Cancel before waiting so that the goroutines stop if we return early.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Batches are sent to the workers and, in the same order, to the
+	// collector below. The capacity of ordered bounds the number of rows in
+	// flight.
+	work := make(chan *rowBatch[T], concurrency)
+	ordered := make(chan *rowBatch[T], 2*concurrency)
+
+	wg.Go(func() {
+		defer close(ordered)
+		defer close(work)
+		for {
+			batch := &rowBatch[T]{done: make(chan struct{})}
+			for len(batch.rows) < rowBatchSize {
+				if err := ctx.Err(); err != nil {
+					batch.err = err
+					break
+				}
+				row, err := csvReader.Read()
+				if err != nil {
+					if !errors.Is(err, io.EOF) {
+						batch.err = err
+					}
+					break
+				}
+				// The reader reuses the row slice.
+				batch.rows = append(batch.rows, slices.Clone(row))
+				batch.positions = append(batch.positions, readPosition(csvReader, len(row)))
+			}
+
+			select {
+			case work <- batch:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case ordered <- batch:
+			case <-ctx.Done():
+				return
+			}
+
+			if len(batch.rows) < rowBatchSize {
+				return
+			}
+		}
+	})
+
+	for range concurrency {
+		wg.Go(func() {
+			for batch := range work {
+				batch.outcomes = make([]T, len(batch.rows))
+				for i, row := range batch.rows {
+					batch.outcomes[i] = verifyRow(row)
+				}
+				close(batch.done)
+			}
+		})
+	}
+
+	for batch := range ordered {
+		<-batch.done
+		for i, outcome := range batch.outcomes {
+			if err := handle(outcome, batch.positions[i]); err != nil {
+				return err
+			}
+		}
+		if batch.err != nil {
+			return batch.err
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,101 @@
+package verify
+
+import (
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// utf8Reader passes data through from r, returning ErrNotUTF8 as soon as it
+// has read data that is not valid UTF-8. Only the valid UTF-8 read before the
+// invalid data is passed through, and ErrNotUTF8 is returned by the following
+// Read. This allows a geofeed's encoding to be checked without holding the
+// whole file in memory.
+type utf8Reader struct {
+	r io.Reader
+	// pending holds the start of a rune that was split across reads. It is
+	// passed through once the rest of the rune has been read.
+	pending []byte
+	// err is the error to return once the data read so far has been passed
+	// through.
+	err error
+}
+
+func newUTF8Reader(r io.Reader) *utf8Reader {
+	return &utf8Reader{r: r, pending: make([]byte, 0, utf8.UTFMax)}
+}
+
+// Read implements io.Reader. It requires len(p) to be at least
+// utf8.UTFMax, so that a rune split across reads can be passed through.
+func (u *utf8Reader) Read(p []byte) (int, error) {
+	if u.err != nil {
+		return 0, u.err
+	}
+	if len(p) < utf8.UTFMax {
+		return 0, io.ErrShortBuffer
+	}
+
+	n := copy(p, u.pending)
+	u.pending = u.pending[:0]
+	for {
+		m, err := u.r.Read(p[n:])
+		n += m
+		data := p[:n]
+
+		complete := len(data) - incompleteRuneSuffix(data)
+		if valid := validPrefix(data[:complete]); valid < complete {
+			return u.fail(valid, ErrNotUTF8)
+		}
+		switch {
+		case errors.Is(err, io.EOF) && complete < len(data):
+			return u.fail(complete, ErrNotUTF8)
+		case err != nil:
+			return u.fail(complete, err)
+		case complete > 0 || n == len(p):
+			u.pending = append(u.pending, data[complete:]...)
+			return complete, nil
+		}
+		// Only the start of a rune has been read so far.
+	}
+}
+
+// fail returns the first n bytes of the data read, deferring err to the next
+// Read unless there is no data to return.
+func (u *utf8Reader) fail(n int, err error) (int, error) {
+	u.err = err
+	if n == 0 {
+		return 0, err
+	}
+	return n, nil
+}
+
+// validPrefix returns the length of the longest prefix of data that is valid
+// UTF-8.
+func validPrefix(data []byte) int {
+	if utf8.Valid(data) {
+		return len(data)
+	}
+	i := 0
+	for i < len(data) {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// incompleteRuneSuffix returns the length of the start of a multi-byte rune
+// at the end of data, or 0 if data does not end with an incomplete rune.
+func incompleteRuneSuffix(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax+1; i-- {
+		if utf8.RuneStart(data[i]) {
+			if utf8.FullRune(data[i:]) {
+				return 0
+			}
+			return len(data) - i
+		}
+	}
+	return 0
+}
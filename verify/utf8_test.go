@@ -0,0 +1,77 @@
+package verify
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUTF8Reader(t *testing.T) {
+	tests := []struct {
+		desc  string
+		data  []byte
+		valid bool
+		// prefix is the data read before ErrNotUTF8 for invalid data.
+		prefix string
+	}{
+		{
+			desc:  "ASCII",
+			data:  []byte("2.125.160.216/29,GB,GB-WBK,Boxford,\n"),
+			valid: true,
+		},
+		{
+			desc:  "multi-byte runes",
+			data:  []byte("89.160.20.112/28,SE,SE-E,Linköping,\n1.0.0.0/24,JP,JP-13,東京,\n"),
+			valid: true,
+		},
+		{
+			desc:  "four-byte rune at end",
+			data:  []byte("city 😀"),
+			valid: true,
+		},
+		{
+			desc:   "Shift-JIS",
+			data:   []byte{'c', 'i', 't', 'y', 0x93, 0x8c, 0x8b, 0x9e},
+			prefix: "city",
+		},
+		{
+			desc:   "truncated rune at end",
+			data:   []byte("city \xe6\x9d"),
+			prefix: "city ",
+		},
+		{
+			desc:   "lone continuation byte",
+			data:   []byte("city \x9d city"),
+			prefix: "city ",
+		},
+		{
+			desc:   "invalid byte after multi-byte rune",
+			data:   []byte("東京\xffbad\n"),
+			prefix: "東京",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			readers := map[string]io.Reader{
+				"whole":    bytes.NewReader(test.data),
+				"one byte": iotest.OneByteReader(bytes.NewReader(test.data)),
+				"half":     iotest.HalfReader(bytes.NewReader(test.data)),
+			}
+			for name, r := range readers {
+				data, err := io.ReadAll(newUTF8Reader(r))
+				if test.valid {
+					require.NoError(t, err, name)
+					assert.Equal(t, test.data, data, name)
+				} else {
+					require.ErrorIs(t, err, ErrNotUTF8, name)
+					assert.Equal(t, test.prefix, string(data), name)
+				}
+			}
+		})
+	}
+}
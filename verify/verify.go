@@ -3,16 +3,19 @@
 package verify
 
 import (
+	"bufio"
 	"bytes"
+	"cmp"
+	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
-	"io"
+	"iter"
 	"net/netip"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
-	"unicode/utf8"
 
 	"github.com/oschwald/maxminddb-golang/v2"
 )
@@ -22,10 +25,16 @@ import (
 // as information about the rows that failed validation.
 // To create new CheckResult instance use NewCheckResult() func.
 type CheckResult struct {
-	Total             int
-	Differences       int
+	Total       int
+	Differences int
+	// DifferenceCounts breaks Differences down by field.
+	DifferenceCounts  DifferenceCounts
 	Invalid           int
 	SampleInvalidRows map[RowInvalidity]string
+	// Database and ISPDatabase describe the MMDBs the geofeed was compared
+	// against. They are nil if the corresponding MMDB was not used.
+	Database    *DatabaseInfo
+	ISPDatabase *DatabaseInfo
 }
 
 // NewCheckResult returns new CheckResult instance.
@@ -51,157 +60,589 @@ type Options struct {
 	// EmptyOK, if set to true, will consider a geofeed with no records to be
 	// valid. The default behavior (false) requires a geofeed to not be empty.
 	EmptyOK bool
+	// Concurrency is the number of goroutines used to verify rows against
+	// the MMDBs. Values below 2 verify rows serially. The results do not
+	// depend on the concurrency; rows are always reported in geofeed order.
+	Concurrency int
+	// Progress, if set, is called periodically while the geofeed is being
+	// processed, as well as once processing has finished. It is called from
+	// the goroutine that is processing the geofeed and should return quickly.
+	Progress func(Progress)
+	// CityEquivalents maps city names, or words within them, to equivalent
+	// ones, e.g., "St" to "Saint" or "Frankfurt am Main" to "Frankfurt".
+	// City names that are equal after replacing equivalents are not reported
+	// as differences. If nil, DefaultCityEquivalents is used.
+	CityEquivalents map[string]string
+	// ExactCityMatch, if set to true, reports city names that are only
+	// equivalent (see CityEquivalent) or prefixes of one another (see
+	// CityPrefix) as differences.
+	ExactCityMatch bool
+	// Locale is the locale of the MMDB city name reported as the current
+	// value, e.g., "de". If empty, or if the MMDB has no name in this locale,
+	// the English name is used. City names match if the geofeed's name
+	// matches the MMDB's name in any locale.
+	Locale string
+	// Gazetteer, if set, is used to look up the coordinates of the city in
+	// each geofeed row, so that the distance to the location in the MMDB can
+	// be reported.
+	Gazetteer *Gazetteer
+	// MinDistance, if positive, is the distance in kilometers below which
+	// the city of a row is not reported as differing from the MMDB, provided
+	// its country matches. The other fields are still compared. It only
+	// applies to rows whose distance is known.
+	MinDistance float64
 }
 
-// ProcessGeofeed attempts to validate a given geofeedFilename.
+// Progress describes how much of a geofeed has been processed.
+type Progress struct {
+	// Rows is the number of rows processed so far.
+	Rows int
+	// Bytes is the number of bytes of the geofeed read so far.
+	Bytes int64
+	// TotalBytes is the size of the geofeed in bytes.
+	TotalBytes int64
+}
+
+// progressInterval is the number of rows between calls to Options.Progress.
+const progressInterval = 1000
+
+// ProcessGeofeed attempts to validate a given geofeedFilename. If the
+// geofeed has invalid rows, the error is an *InvalidGeofeedError, which wraps
+// ErrInvalidGeofeed and a *RowError for each of the first
+// MaxInvalidRowErrors invalid rows.
+//
+// If mmdbFilename is not empty, the rows are compared against that City or
+// Country MMDB. If ispFilename is also not empty, the AS number and
+// organization of each row are looked up in that ISP or ASN MMDB, e.g.,
+// GeoIP2-ISP or GeoLite2-ASN, along with the ISP name for ISP databases. The
+// type of each database is read from its metadata; if it does not match its
+// purpose, the error wraps ErrUnsupportedDatabase.
 func ProcessGeofeed(
 	geofeedFilename,
 	mmdbFilename,
 	ispFilename string,
 	opts Options,
 ) (CheckResult, []string, map[uint]int, error) {
-	c := NewCheckResult()
+	return ProcessGeofeedContext(
+		context.Background(),
+		geofeedFilename,
+		mmdbFilename,
+		ispFilename,
+		opts,
+	)
+}
+
+// ProcessGeofeedContext is like ProcessGeofeed, but stops processing and
+// returns the context's error if ctx is canceled. The results returned in
+// that case cover the rows processed before cancellation.
+func ProcessGeofeedContext(
+	ctx context.Context,
+	geofeedFilename,
+	mmdbFilename,
+	ispFilename string,
+	opts Options,
+) (CheckResult, []string, map[uint]int, error) {
 	var diffLines []string
+	c, asnCounts, err := StreamGeofeed(
+		ctx,
+		geofeedFilename,
+		mmdbFilename,
+		ispFilename,
+		opts,
+		func(r RowResult) error {
+			if r.Diff != "" {
+				diffLines = append(diffLines, r.Diff)
+			}
+			return nil
+		},
+	)
+	return c, diffLines, asnCounts, err
+}
 
-	geofeedData, err := os.ReadFile(filepath.Clean(geofeedFilename))
-	if err != nil {
-		if opts.HideFilePathsInErrorMessages {
-			return c, diffLines, nil, fmt.Errorf("unable to open file: %w", err)
-		}
-		return c, diffLines, nil, fmt.Errorf("unable to open %s: %w", geofeedFilename, err)
-	}
+// RowResult is the outcome of verifying a single geofeed row.
+type RowResult struct {
+	// Line is the line of the geofeed on which the row starts. Comments and
+	// blank lines are counted, so this may differ from the number of rows.
+	Line int
+	// Row holds the fields of the row, with surrounding whitespace removed
+	// from the RFC 8805 fields.
+	Row []string
+	// Err is set if the row does not comply with RFC 8805 or could not be
+	// verified against the MMDBs.
+	Err *RowError
+	// Comparison is the result of comparing a valid row against the MMDBs.
+	// It is nil if the row is invalid or no MMDB was provided.
+	Comparison *Comparison
+	// Diff describes how a valid row differs from the MMDB, in the same
+	// format as the diff lines returned by ProcessGeofeed. It is empty if
+	// the row does not differ or no MMDB was provided.
+	Diff string
+}
 
-	// Strip UTF-8 BOM if present (common on files from Windows).
-	geofeedData = bytes.TrimPrefix(geofeedData, []byte{0xEF, 0xBB, 0xBF})
+// StreamGeofeed is like ProcessGeofeedContext, but rather than collecting
+// the diff lines, it calls handle with the result of each row, in geofeed
+// order, as soon as the row has been verified. The geofeed is read
+// incrementally, so memory use does not depend on its size. Note that the
+// encoding of the geofeed is checked as it is read; if it is not valid
+// UTF-8, ErrNotUTF8 is returned after handle has been called for the rows
+// before the invalid data.
+//
+// If handle returns an error, processing stops and that error is returned.
+func StreamGeofeed(
+	ctx context.Context,
+	geofeedFilename,
+	mmdbFilename,
+	ispFilename string,
+	opts Options,
+	handle func(RowResult) error,
+) (CheckResult, map[uint]int, error) {
+	c := NewCheckResult()
 
-	if !utf8.Valid(geofeedData) {
-		return c, diffLines, nil, ErrNotUTF8
+	gf, err := openGeofeed(geofeedFilename, opts)
+	if err != nil {
+		return c, nil, err
 	}
+	defer gf.Close()
 
-	var db, ispdb *maxminddb.Reader
+	v := &verifier{opts: opts, cities: newCityMatcher(opts)}
 	if mmdbFilename != "" {
-		db, err = maxminddb.Open(filepath.Clean(mmdbFilename))
+		v.db, err = openLocationMMDB(mmdbFilename, opts)
 		if err != nil {
-			if opts.HideFilePathsInErrorMessages {
-				return c, diffLines, nil, fmt.Errorf("unable to open MMDB: %w", err)
-			}
-			return c, diffLines, nil, fmt.Errorf("unable to open MMDB %s: %w", mmdbFilename, err)
+			return c, nil, err
 		}
-		defer db.Close()
+		defer v.db.Close()
+		v.fields = databaseFields(v.db.Metadata.DatabaseType)
 
 		if ispFilename != "" {
-			ispdb, err = maxminddb.Open(filepath.Clean(ispFilename))
+			v.ispdb, err = openNetworkMMDB(ispFilename, opts)
 			if err != nil {
-				if opts.HideFilePathsInErrorMessages {
-					return c, diffLines, nil, fmt.Errorf("unable to open ISP MMDB: %w", err)
-				}
-				return c, diffLines, nil, fmt.Errorf(
-					"unable to open ISP MMDB %s: %w",
-					ispFilename,
-					err,
-				)
+				return c, nil, err
 			}
-			defer ispdb.Close()
+			defer v.ispdb.Close()
 		}
 	}
+
 	asnCounts := map[uint]int{}
+	differences := 0
+	var counts DifferenceCounts
+	c, err = streamRows(ctx, gf, geofeedFilename, []*verifier{v}, opts, func(vr verifiedRow) error {
+		r := RowResult{Line: vr.line, Row: vr.row, Err: vr.err}
+		if vr.err == nil {
+			if vr.asNumber > 0 {
+				asnCounts[vr.asNumber]++
+			}
+			r.Comparison = vr.comparisons[0]
+			if r.Comparison != nil {
+				r.Diff = r.Comparison.diff()
+			}
+			if r.Diff != "" {
+				differences++
+				counts.add(r.Comparison.Differences)
+			}
+		}
+		return handle(r)
+	})
+	c.Differences = differences
+	c.DifferenceCounts = counts
+	if v.db != nil {
+		c.Database = newDatabaseInfo(v.db.Metadata)
+	}
+	if v.ispdb != nil {
+		c.ISPDatabase = newDatabaseInfo(v.ispdb.Metadata)
+	}
+	return c, asnCounts, err
+}
 
-	csvReader := csv.NewReader(bytes.NewReader(geofeedData))
-	csvReader.ReuseRecord = true
-	csvReader.Comment = '#'
-	csvReader.FieldsPerRecord = -1
-	csvReader.TrimLeadingSpace = true
+// verifiedRow is a geofeed row that was verified against the MMDBs of one or
+// more verifiers.
+type verifiedRow struct {
+	// line is the line on which the row starts.
+	line int
+	row  []string
+	// err describes why the row is invalid. It is nil for valid rows.
+	err *RowError
+	// comparisons holds the comparison against each verifier's MMDB, in the
+	// order of the verifiers, for valid rows. The comparisons are nil if a
+	// verifier has no MMDB.
+	comparisons []*Comparison
+	// asNumber is the AS number found by the first verifier, if any.
+	asNumber uint
+}
 
-	const expectedFieldsPerRecord = 5
+// streamRows verifies the rows of the geofeed against each of the verifiers
+// and calls handle with each verified row, in geofeed order. A row is
+// invalid if any verifier finds it invalid. The returned CheckResult counts
+// the rows and the invalid rows; counting differences is up to handle. The
+// error is that of handle, the context's error, a read error,
+// ErrEmptyGeofeed or an *InvalidGeofeedError, in that order.
+func streamRows(
+	ctx context.Context,
+	gf *geofeedFile,
+	geofeedFilename string,
+	verifiers []*verifier,
+	opts Options,
+	handle func(verifiedRow) error,
+) (CheckResult, error) {
+	c := NewCheckResult()
 
-	for {
-		row, err := csvReader.Read()
-		if errors.Is(err, io.EOF) {
-			break
+	var bytesRead int64
+	reportProgress := func() {
+		if opts.Progress != nil {
+			opts.Progress(Progress{
+				Rows:       c.Total,
+				Bytes:      bytesRead,
+				TotalBytes: gf.size,
+			})
 		}
-		if err != nil {
-			if opts.HideFilePathsInErrorMessages {
-				return c, diffLines, asnCounts, fmt.Errorf("unable to read next row: %w", err)
+	}
+
+	type rowOutcome struct {
+		row         []string
+		comparisons []*Comparison
+		result      verificationResult
+	}
+
+	var (
+		invalid   InvalidGeofeedError
+		handleErr error
+	)
+	err := processRows(
+		ctx,
+		gf.csv,
+		opts.Concurrency,
+		func(row []string) rowOutcome {
+			if len(row) < expectedFieldsPerRecord {
+				return rowOutcome{row: row, result: fewerFieldsResult(row)}
+			}
+			o := rowOutcome{row: row}
+			for i, v := range verifiers {
+				comparison, result := v.verifyCorrection(row[:expectedFieldsPerRecord])
+				if !result.valid {
+					return rowOutcome{row: row, result: result}
+				}
+				if i == 0 {
+					o.result = result
+				}
+				o.comparisons = append(o.comparisons, comparison)
+			}
+			return o
+		},
+		func(o rowOutcome, pos rowPosition) error {
+			c.Total++
+			bytesRead = gf.offset + pos.offset
+
+			vr := verifiedRow{
+				line: pos.line(),
+				row:  o.row,
+			}
+			if o.result.valid {
+				vr.comparisons = o.comparisons
+				vr.asNumber = o.result.asNumber
+			} else {
+				vr.err = o.result.rowError(pos, o.row)
+				c.addInvalid(vr.err)
+				invalid.add(vr.err)
 			}
-			return c, diffLines, asnCounts, fmt.Errorf(
-				"unable to read next row in %s: %w",
-				geofeedFilename,
-				err,
-			)
-		}
 
-		c.Total++
-
-		if len(row) < expectedFieldsPerRecord {
-			if _, ok := c.SampleInvalidRows[FewerFieldsThanExpected]; !ok {
-				c.SampleInvalidRows[FewerFieldsThanExpected] = fmt.Sprintf(
-					"line %d: expected %d fields but got %d, row: '%s'",
-					c.Total,
-					expectedFieldsPerRecord,
-					len(row),
-					strings.Join(row, ","),
-				)
+			if c.Total%progressInterval == 0 {
+				reportProgress()
 			}
-			c.Invalid++
-			continue
+
+			handleErr = handle(vr)
+			return handleErr
+		},
+	)
+	if err != nil {
+		if handleErr != nil {
+			return c, handleErr
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return c, ctxErr
 		}
+		return c, readRowError(geofeedFilename, err, opts)
+	}
+
+	bytesRead = gf.size
+	reportProgress()
+
+	if c.Total == 0 && !opts.EmptyOK {
+		return c, ErrEmptyGeofeed
+	}
 
-		diffLine, result := verifyCorrection(
-			row[:expectedFieldsPerRecord],
-			db,
-			ispdb,
-			asnCounts,
+	if invalid.Invalid > 0 {
+		return c, &invalid
+	}
+
+	return c, nil
+}
+
+// errStopIteration is returned from the StreamGeofeed handler when the
+// consumer of a RowResults iterator stops iterating.
+var errStopIteration = errors.New("iteration stopped")
+
+// RowResults returns an iterator over the results of verifying the rows of a
+// geofeed, as produced by StreamGeofeed. Each row's result is yielded with a
+// nil error. If processing fails or the geofeed is invalid, a final zero
+// RowResult is yielded along with the error StreamGeofeed would return, e.g.,
+// an error wrapping ErrInvalidGeofeed. Stopping the iteration early stops
+// processing the geofeed.
+//
+//	for r, err := range verify.RowResults(ctx, gf, db, "", opts) {
+//		if err != nil {
+//			return err
+//		}
+//		if r.Diff != "" {
+//			fmt.Println(r.Diff)
+//		}
+//	}
+func RowResults(
+	ctx context.Context,
+	geofeedFilename,
+	mmdbFilename,
+	ispFilename string,
+	opts Options,
+) iter.Seq2[RowResult, error] {
+	return func(yield func(RowResult, error) bool) {
+		_, _, err := StreamGeofeed(
+			ctx,
+			geofeedFilename,
+			mmdbFilename,
+			ispFilename,
 			opts,
+			func(r RowResult) error {
+				if !yield(r, nil) {
+					return errStopIteration
+				}
+				return nil
+			},
 		)
-		if !result.valid {
-			if _, ok := c.SampleInvalidRows[result.invalidityType]; !ok {
-				c.SampleInvalidRows[result.invalidityType] = fmt.Sprintf(
-					"line %d: %s",
-					c.Total,
-					result.invalidityReason,
-				)
-			}
-			c.Invalid++
-			continue
+		if err != nil && !errors.Is(err, errStopIteration) {
+			yield(RowResult{}, err)
 		}
+	}
+}
+
+const expectedFieldsPerRecord = 5
+
+// geofeedFile is an open geofeed.
+type geofeedFile struct {
+	csv  *csv.Reader
+	file *os.File
+	// size is the size of the file in bytes.
+	size int64
+	// offset is the number of bytes before the data read by csv, i.e., the
+	// length of the BOM, if any.
+	offset int64
+}
 
-		if diffLine != "" {
-			diffLines = append(diffLines, diffLine)
-			c.Differences++
+// openGeofeed opens geofeedFilename and returns a geofeedFile with a CSV
+// reader configured for RFC 8805 records. The file is read incrementally; if
+// it is not valid UTF-8, reading a row returns an error wrapping ErrNotUTF8.
+func openGeofeed(geofeedFilename string, opts Options) (*geofeedFile, error) {
+	f, err := os.Open(filepath.Clean(geofeedFilename))
+	if err != nil {
+		return nil, openGeofeedError(geofeedFilename, err, opts)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, openGeofeedError(geofeedFilename, err, opts)
+	}
+	gf := &geofeedFile{file: f, size: info.Size()}
+
+	// Strip UTF-8 BOM if present (common on files from Windows).
+	r := bufio.NewReader(f)
+	bom := []byte{0xEF, 0xBB, 0xBF}
+	if b, err := r.Peek(len(bom)); err == nil && bytes.Equal(b, bom) {
+		if _, err := r.Discard(len(bom)); err != nil {
+			f.Close()
+			return nil, openGeofeedError(geofeedFilename, err, opts)
 		}
+		gf.offset = int64(len(bom))
+	}
+
+	gf.csv = csv.NewReader(newUTF8Reader(r))
+	gf.csv.ReuseRecord = true
+	gf.csv.Comment = '#'
+	gf.csv.FieldsPerRecord = -1
+	gf.csv.TrimLeadingSpace = true
+
+	return gf, nil
+}
+
+func openGeofeedError(geofeedFilename string, err error, opts Options) error {
+	if opts.HideFilePathsInErrorMessages {
+		return fmt.Errorf("unable to open file: %w", err)
 	}
-	if err != nil && !errors.Is(err, io.EOF) {
+	return fmt.Errorf("unable to open %s: %w", geofeedFilename, err)
+}
+
+// Close closes the underlying file.
+func (gf *geofeedFile) Close() error {
+	return gf.file.Close()
+}
+
+// openMMDB opens an MMDB file. description names the kind of database in
+// error messages.
+func openMMDB(filename, description string, opts Options) (*maxminddb.Reader, error) {
+	db, err := maxminddb.Open(filepath.Clean(filename))
+	if err != nil {
 		if opts.HideFilePathsInErrorMessages {
-			return c, diffLines, asnCounts, fmt.Errorf("error reading file: %w", err)
+			return nil, fmt.Errorf("unable to open %s: %w", description, err)
 		}
-		return c, diffLines, asnCounts, fmt.Errorf(
-			"error while reading %s: %w",
-			geofeedFilename,
-			err,
-		)
+		return nil, fmt.Errorf("unable to open %s %s: %w", description, filename, err)
 	}
+	return db, nil
+}
 
-	if c.Total == 0 && !opts.EmptyOK {
-		return c, diffLines, asnCounts, ErrEmptyGeofeed
+// openLocationMMDB opens a City or Country MMDB.
+func openLocationMMDB(filename string, opts Options) (*maxminddb.Reader, error) {
+	db, err := openMMDB(filename, "MMDB", opts)
+	if err != nil {
+		return nil, err
+	}
+	if !isLocationDatabase(db.Metadata.DatabaseType) {
+		err := unsupportedDatabaseError(filename, "MMDB", db, opts)
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// openNetworkMMDB opens an ISP or ASN MMDB.
+func openNetworkMMDB(filename string, opts Options) (*maxminddb.Reader, error) {
+	db, err := openMMDB(filename, "ISP MMDB", opts)
+	if err != nil {
+		return nil, err
+	}
+	if !isNetworkDatabase(db.Metadata.DatabaseType) {
+		err := unsupportedDatabaseError(filename, "ISP MMDB", db, opts)
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// isNetworkDatabase reports whether MMDBs of the given database type hold the
+// AS number and organization of the networks, as ISP databases, e.g.,
+// "GeoIP2-ISP", and ASN databases, e.g., "GeoLite2-ASN", do. Only ISP
+// databases hold the ISP name as well.
+func isNetworkDatabase(databaseType string) bool {
+	return strings.Contains(databaseType, "ISP") || strings.Contains(databaseType, "ASN")
+}
+
+// nonLocationDatabaseTypes are the parts of the types of databases that hold
+// data about the networks rather than their location.
+var nonLocationDatabaseTypes = []string{
+	"ISP",
+	"ASN",
+	"Anonymous-IP",
+	"Connection-Type",
+	"Domain",
+}
+
+// isLocationDatabase reports whether MMDBs of the given database type may
+// hold location data with the City or Country record structure. Only known
+// types without location data, e.g., "GeoIP2-ISP" or "GeoIP2-Anonymous-IP",
+// are rejected, so that custom City databases may be used as well.
+func isLocationDatabase(databaseType string) bool {
+	return !slices.ContainsFunc(nonLocationDatabaseTypes, func(t string) bool {
+		return strings.Contains(databaseType, t)
+	})
+}
+
+func unsupportedDatabaseError(
+	filename,
+	description string,
+	db *maxminddb.Reader,
+	opts Options,
+) error {
+	if opts.HideFilePathsInErrorMessages {
+		return fmt.Errorf(
+			"%w for the %s: %s",
+			ErrUnsupportedDatabase,
+			description,
+			db.Metadata.DatabaseType,
+		)
 	}
+	return fmt.Errorf(
+		"%w for the %s %s: %s",
+		ErrUnsupportedDatabase,
+		description,
+		filename,
+		db.Metadata.DatabaseType,
+	)
+}
 
-	if c.Invalid > 0 || len(c.SampleInvalidRows) > 0 {
-		return c, diffLines, asnCounts, ErrInvalidGeofeed
+func readRowError(geofeedFilename string, err error, opts Options) error {
+	if errors.Is(err, ErrNotUTF8) {
+		return ErrNotUTF8
 	}
+	if opts.HideFilePathsInErrorMessages {
+		return fmt.Errorf("unable to read next row: %w", err)
+	}
+	return fmt.Errorf("unable to read next row in %s: %w", geofeedFilename, err)
+}
 
-	return c, diffLines, asnCounts, nil
+// addInvalid records an invalid row, keeping the first example of each
+// invalidity type.
+func (c *CheckResult) addInvalid(rowErr *RowError) {
+	if _, ok := c.SampleInvalidRows[rowErr.Invalidity]; !ok {
+		c.SampleInvalidRows[rowErr.Invalidity] = rowErr.Error()
+	}
+	c.Invalid++
 }
 
 type verificationResult struct {
 	valid            bool
 	invalidityType   RowInvalidity
 	invalidityReason string
+	// field is the index of the field at fault for an invalid row, or -1.
+	field int
+	// value is the value of the field at fault for an invalid row.
+	value string
+	// asNumber is the AS number found for a valid row, if any.
+	asNumber uint
+}
+
+// rowError returns the RowError for an invalid row read from pos. The error
+// points at the field at fault or, if there is none, at the start of the row.
+func (r verificationResult) rowError(pos rowPosition, row []string) *RowError {
+	line, column := pos.line(), 0
+	if r.field >= 0 && r.field < len(pos.fields) {
+		line, column = pos.fields[r.field].line, pos.fields[r.field].column
+	}
+	return &RowError{
+		Line:       line,
+		Column:     column,
+		Field:      r.field,
+		Invalidity: r.invalidityType,
+		Value:      r.value,
+		Row:        slices.Clone(row),
+		Reason:     r.invalidityReason,
+	}
+}
+
+func fewerFieldsResult(row []string) verificationResult {
+	return verificationResult{
+		valid:          false,
+		invalidityType: FewerFieldsThanExpected,
+		field:          -1,
+		invalidityReason: fmt.Sprintf(
+			"expected %d fields but got %d, row: '%s'",
+			expectedFieldsPerRecord,
+			len(row),
+			strings.Join(row, ","),
+		),
+	}
 }
 
 func invalidRegionCodeResult(correction []string) verificationResult {
 	return verificationResult{
 		valid:          false,
 		invalidityType: InvalidRegionCode,
+		field:          2,
+		value:          correction[2],
 		invalidityReason: fmt.Sprintf(
 			"invalid ISO 3166-2 region code format in strict (default) mode, row: '%s'",
 			strings.Join(correction, ","),
@@ -209,27 +650,19 @@ func invalidRegionCodeResult(correction []string) verificationResult {
 	}
 }
 
-func verifyCorrection(
-	correction []string,
-	db, ispdb *maxminddb.Reader,
-	asnCounts map[uint]int,
-	opts Options,
-) (string, verificationResult) {
-	/*
-	   0: network (CIDR or single IP)
-	   1: ISO-3166 country code
-	   2: ISO-3166-2 region code
-	   3: city name
-	   4: postal code
-	*/
-
-	for i, v := range correction {
-		correction[i] = strings.TrimSpace(v)
-	}
+// regionCodeFormatOK reports whether region has a format that is acceptable
+// without consulting a database. ISO-3166-2 region codes are prefixed with the
+// ISO country code; in strict (default) mode we require this format.
+func regionCodeFormatOK(region string, opts Options) bool {
+	return region == "" || strings.Contains(region, "-") || opts.LaxMode
+}
 
+// parseNetwork parses the network field of a trimmed correction. A single IP
+// address is treated as a network of its own.
+func parseNetwork(correction []string) (string, netip.Prefix, verificationResult) {
 	networkOrIP := correction[0]
 	if networkOrIP == "" {
-		return "", verificationResult{
+		return "", netip.Prefix{}, verificationResult{
 			valid:          false,
 			invalidityType: EmptyNetwork,
 			invalidityReason: fmt.Sprintf(
@@ -247,76 +680,80 @@ func verifyCorrection(
 	}
 	network, err := netip.ParsePrefix(networkOrIP)
 	if err != nil {
-		return "", verificationResult{
+		return networkOrIP, netip.Prefix{}, verificationResult{
 			valid:            false,
 			invalidityType:   UnableToParseNetwork,
+			value:            correction[0],
 			invalidityReason: fmt.Sprintf("unable to parse network %s: %s", networkOrIP, err),
 		}
 	}
+	return networkOrIP, network, verificationResult{
+		valid:            true,
+		invalidityType:   RowInvalidity(-1),
+		invalidityReason: "",
+	}
+}
 
-	if db == nil {
-		// format-only mode: only the DB-independent region-code format rule applies.
-		if !strings.Contains(correction[2], "-") && correction[2] != "" && !opts.LaxMode {
-			return "", invalidRegionCodeResult(correction)
-		}
-		return "", verificationResult{
-			valid:            true,
-			invalidityType:   RowInvalidity(-1),
-			invalidityReason: "",
-		}
+// verifier compares geofeed rows against the MMDBs.
+type verifier struct {
+	db, ispdb *maxminddb.Reader
+	opts      Options
+	cities    *cityMatcher
+	// fields are the location fields provided by db.
+	fields []Field
+}
+
+// databaseFields returns the location fields provided by MMDBs of the given
+// location database type, e.g., "GeoIP2-City". Country databases, e.g.,
+// "GeoLite2-Country", only provide the country; City and Enterprise databases
+// provide all the fields.
+func databaseFields(databaseType string) []Field {
+	if strings.Contains(databaseType, "Country") {
+		return []Field{CountryField}
 	}
+	return []Field{CountryField, RegionField, CityField, PostalCodeField}
+}
 
-	// XXX - should we be checking the whole network?
-	result := db.Lookup(network.Addr())
+func (v *verifier) verifyCorrection(correction []string) (*Comparison, verificationResult) {
+	/*
+	   0: network (CIDR or single IP)
+	   1: ISO-3166 country code
+	   2: ISO-3166-2 region code
+	   3: city name
+	   4: postal code
+	*/
 
-	var mostSpecificSubdivision string
-	err = result.DecodePath(&mostSpecificSubdivision, "subdivisions", -1, "iso_code")
-	if err != nil {
-		return "", verificationResult{
-			valid:          false,
-			invalidityType: UnableToFindCityRecord,
-			invalidityReason: fmt.Sprintf(
-				"unable to find city record for %s: %s",
-				networkOrIP,
-				err,
-			),
-		}
+	for i, v := range correction {
+		correction[i] = strings.TrimSpace(v)
 	}
 
-	var countryCode string
-	err = result.DecodePath(&countryCode, "country", "iso_code")
-	if err != nil {
-		return "", verificationResult{
-			valid:          false,
-			invalidityType: UnableToFindCityRecord,
-			invalidityReason: fmt.Sprintf(
-				"unable to find city record for %s: %s",
-				networkOrIP,
-				err,
-			),
-		}
+	networkOrIP, network, parsed := parseNetwork(correction)
+	if !parsed.valid {
+		return nil, parsed
 	}
 
-	var cityName string
-	err = result.DecodePath(&cityName, "city", "names", "en")
-	if err != nil {
-		return "", verificationResult{
-			valid:          false,
-			invalidityType: UnableToFindCityRecord,
-			invalidityReason: fmt.Sprintf(
-				"unable to find city record for %s: %s",
-				networkOrIP,
-				err,
-			),
+	if v.db == nil {
+		// format-only mode: only the DB-independent region-code format rule applies.
+		if !regionCodeFormatOK(correction[2], v.opts) {
+			return nil, invalidRegionCodeResult(correction)
+		}
+		return nil, verificationResult{
+			valid:            true,
+			invalidityType:   RowInvalidity(-1),
+			invalidityReason: "",
 		}
 	}
 
-	var postalCode string
-	err = result.DecodePath(&postalCode, "postal", "code")
+	// XXX - should we be checking the whole network?
+	result := v.db.Lookup(network.Addr())
+
+	var record cityRecord
+	err := result.Decode(&record)
 	if err != nil {
-		return "", verificationResult{
+		return nil, verificationResult{
 			valid:          false,
 			invalidityType: UnableToFindCityRecord,
+			value:          networkOrIP,
 			invalidityReason: fmt.Sprintf(
 				"unable to find city record for %s: %s",
 				networkOrIP,
@@ -328,27 +765,29 @@ func verifyCorrection(
 	// ISO-3166-2 region codes are prefixed with the ISO country code,
 	// in strict (default) mode we require this format.
 	// In "--lax" mode both region code formats (with or without country code) are accepted.
-	if strings.Contains(correction[2], "-") {
-		mostSpecificSubdivision = countryCode + "-" + mostSpecificSubdivision
-	} else if correction[2] != "" && !opts.LaxMode {
-		return "", invalidRegionCodeResult(correction)
+	prefixed := strings.Contains(correction[2], "-")
+	if !prefixed && correction[2] != "" && !v.opts.LaxMode {
+		return nil, invalidRegionCodeResult(correction)
 	}
+	subdivisions := record.subdivisionCodes(prefixed)
 
 	asNumber := uint(0)
 	asName := ""
 	ispName := ""
-	if ispdb != nil {
+	if v.ispdb != nil {
 		var ispRecord struct {
 			AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
 			AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
 			ISP                          string `maxminddb:"isp"`
 		}
+		// ASN databases have no ISP name, which is then left empty.
 		// XXX - should we be checking the whole network?
-		err := ispdb.Lookup(network.Addr()).Decode(&ispRecord)
+		err := v.ispdb.Lookup(network.Addr()).Decode(&ispRecord)
 		if err != nil {
-			return "", verificationResult{
+			return nil, verificationResult{
 				valid:          false,
 				invalidityType: UnableToFindISPRecord,
+				value:          networkOrIP,
 				invalidityReason: fmt.Sprintf(
 					"unable to find ISP record for %s: %s",
 					networkOrIP,
@@ -360,102 +799,94 @@ func verifyCorrection(
 		asName = ispRecord.AutonomousSystemOrganization
 		ispName = ispRecord.ISP
 	}
-	if asNumber > 0 {
-		asnCounts[asNumber]++
-	}
-
-	const indent = "\t\t"
 
-	foundDiff := false
-	lines := []string{fmt.Sprintf("\nFound a potential improvement: '%s'", networkOrIP)}
-
-	if !(strings.EqualFold(correction[1], countryCode)) {
-		foundDiff = true
-		lines = append(
-			lines,
-			fmt.Sprintf(
-				"current country: '%s'%ssuggested country: '%s'",
-				countryCode,
-				indent,
-				correction[1],
-			),
-		)
+	comparison := &Comparison{
+		Network: networkOrIP,
+		Suggested: Location{
+			Country:    correction[1],
+			Region:     correction[2],
+			City:       correction[3],
+			PostalCode: correction[4],
+		},
+		Current: Location{
+			Country:    record.Country.ISOCode,
+			City:       cityName(record.City.Names, v.opts.Locale),
+			PostalCode: record.Postal.Code,
+		},
+		Fields:         v.fields,
+		ASNumber:       asNumber,
+		ASOrganization: asName,
+		ISP:            ispName,
 	}
-
-	if !(strings.EqualFold(correction[2], mostSpecificSubdivision)) {
-		foundDiff = true
-		lines = append(
-			lines,
-			fmt.Sprintf(
-				"current region: '%s'%ssuggested region: '%s'",
-				mostSpecificSubdivision,
-				indent,
-				correction[2],
-			),
-		)
+	if n := len(subdivisions); n > 0 {
+		comparison.Current.Region = subdivisions[n-1]
 	}
-
-	if !(strings.EqualFold(correction[3], cityName)) {
-		foundDiff = true
-		lines = append(
-			lines,
-			fmt.Sprintf(
-				"current city: '%s'%ssuggested city: '%s'",
-				cityName,
-				indent,
-				correction[3],
-			),
-		)
+	comparison.RegionMatch, comparison.RegionLevel = matchRegion(correction[2], subdivisions)
+	comparison.CityMatch, comparison.CityLocale = v.cities.matchNames(
+		correction[3],
+		record.City.Names,
+		cmp.Or(v.opts.Locale, "en"),
+	)
+	countryDiffers := !strings.EqualFold(correction[1], record.Country.ISOCode)
+	if countryDiffers {
+		comparison.Differences = append(comparison.Differences, CountryField)
+	}
+	if comparison.RegionMatch == RegionMismatch && slices.Contains(v.fields, RegionField) {
+		comparison.Differences = append(comparison.Differences, RegionField)
+	}
+	if !v.cities.equal(comparison.CityMatch) && slices.Contains(v.fields, CityField) {
+		comparison.Differences = append(comparison.Differences, CityField)
 	}
-
 	// if no postal code is provided in the correction, do not report on any
 	// differences; postal codes are frequently omitted, and as of 2020-08-01 are
 	// the postal code field is considered deprecated in RFC 8805
-	if correction[4] != "" && !(strings.EqualFold(correction[4], postalCode)) {
-		foundDiff = true
-		lines = append(
-			lines,
-			fmt.Sprintf(
-				"current postal code: '%s'%ssuggested postal code: '%s'",
-				postalCode,
-				indent,
-				correction[4],
-			),
+	if correction[4] != "" && !(strings.EqualFold(correction[4], record.Postal.Code)) &&
+		slices.Contains(v.fields, PostalCodeField) {
+		comparison.Differences = append(comparison.Differences, PostalCodeField)
+	}
+	v.addDistance(comparison, record)
+	// A different city name close to the MMDB location is likely a suburb or
+	// a neighboring town, but the other fields are still compared.
+	if comparison.Distance != nil && *comparison.Distance < v.opts.MinDistance &&
+		!countryDiffers {
+		comparison.Differences = slices.DeleteFunc(
+			comparison.Differences,
+			func(f Field) bool { return f == CityField },
 		)
 	}
 
-	if foundDiff {
-		if asNumber > 0 {
-			lines = append(
-				lines,
-				fmt.Sprintf(
-					"AS Number: %d",
-					asNumber,
-				),
-			)
-		}
-		if asName != "" {
-			lines = append(
-				lines,
-				"AS Name: "+asName,
-			)
-		}
-		if ispName != "" {
-			lines = append(
-				lines,
-				"ISP Name: "+ispName,
-			)
-		}
-
-		return strings.Join(lines, "\n"+indent), verificationResult{
-			valid:            true,
-			invalidityType:   RowInvalidity(-1),
-			invalidityReason: "",
-		}
-	}
-	return "", verificationResult{
+	return comparison, verificationResult{
 		valid:            true,
 		invalidityType:   RowInvalidity(-1),
 		invalidityReason: "",
+		asNumber:         asNumber,
+	}
+}
+
+// cityName returns the name of a city in locale, falling back to English.
+func cityName(names map[string]string, locale string) string {
+	if name, ok := names[locale]; ok && locale != "" {
+		return name
+	}
+	return names["en"]
+}
+
+// addDistance sets the distance between the suggested city and the location
+// in the MMDB record, if both are known.
+func (v *verifier) addDistance(comparison *Comparison, record cityRecord) {
+	loc := record.Location
+	if v.opts.Gazetteer == nil || loc.Latitude == nil || loc.Longitude == nil {
+		return
+	}
+	suggested, ok := v.opts.Gazetteer.Lookup(
+		comparison.Suggested.Country,
+		comparison.Suggested.Region,
+		comparison.Suggested.City,
+	)
+	if !ok {
+		return
 	}
+	distance := suggested.Distance(Coordinates{Latitude: *loc.Latitude, Longitude: *loc.Longitude})
+	comparison.Distance = &distance
+	comparison.AccuracyRadius = loc.AccuracyRadius
 }
@@ -1,12 +1,32 @@
 package verify
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+const cityTestDatabase = "test_data/GeoIP2-City-Test.mmdb"
+
+// cityTestDatabaseInfo describes cityTestDatabase.
+var cityTestDatabaseInfo = &DatabaseInfo{
+	DatabaseType: "GeoIP2-City",
+	BuildEpoch:   1600886352,
+	IPVersion:    6,
+	Languages:    []string{"en", "zh"},
+}
+
 type processGeofeedTest struct {
 	gf      string
 	db      string
@@ -29,6 +49,7 @@ func TestProcessGeofeed_Valid(t *testing.T) {
 			c: CheckResult{
 				Total:             3,
 				Differences:       2,
+				DifferenceCounts:  DifferenceCounts{Country: 2, Region: 2, City: 2, PostalCode: 1},
 				SampleInvalidRows: map[RowInvalidity]string{},
 			},
 			laxMode: false,
@@ -43,6 +64,7 @@ func TestProcessGeofeed_Valid(t *testing.T) {
 			c: CheckResult{
 				Total:             3,
 				Differences:       2,
+				DifferenceCounts:  DifferenceCounts{Country: 2, Region: 2, City: 2, PostalCode: 1},
 				SampleInvalidRows: map[RowInvalidity]string{},
 			},
 			laxMode: true,
@@ -57,6 +79,7 @@ func TestProcessGeofeed_Valid(t *testing.T) {
 			c: CheckResult{
 				Total:             3,
 				Differences:       2,
+				DifferenceCounts:  DifferenceCounts{Country: 2, Region: 2, City: 2, PostalCode: 1},
 				SampleInvalidRows: map[RowInvalidity]string{},
 			},
 			laxMode: true,
@@ -71,6 +94,7 @@ func TestProcessGeofeed_Valid(t *testing.T) {
 			c: CheckResult{
 				Total:             3,
 				Differences:       2,
+				DifferenceCounts:  DifferenceCounts{Country: 2, Region: 1, City: 1, PostalCode: 1},
 				SampleInvalidRows: map[RowInvalidity]string{},
 			},
 			laxMode: false,
@@ -85,6 +109,7 @@ func TestProcessGeofeed_Valid(t *testing.T) {
 			c: CheckResult{
 				Total:             3,
 				Differences:       2,
+				DifferenceCounts:  DifferenceCounts{Country: 2, Region: 2, City: 2, PostalCode: 1},
 				SampleInvalidRows: map[RowInvalidity]string{},
 			},
 			laxMode: false,
@@ -123,6 +148,9 @@ func TestProcessGeofeed_Valid(t *testing.T) {
 						"got expected substring: '%s', substring",
 					)
 				}
+				if test.db == cityTestDatabase {
+					test.c.Database = cityTestDatabaseInfo
+				}
 				assert.Equal(t, test.c, c, "processGeofeed returned expected results")
 			},
 		)
@@ -150,11 +178,12 @@ func TestProcessGeofeed_Invalid(t *testing.T) {
 			gf: "test_data/geofeed-invalid-empty-network.csv",
 			db: "test_data/GeoIP2-City-Test.mmdb",
 			c: CheckResult{
-				Total:       2,
-				Differences: 1,
-				Invalid:     1,
+				Total:            2,
+				Differences:      1,
+				DifferenceCounts: DifferenceCounts{Country: 1, Region: 1, City: 1, PostalCode: 1},
+				Invalid:          1,
 				SampleInvalidRows: map[RowInvalidity]string{
-					EmptyNetwork: "line 2: network field is empty, row: ',,,,'",
+					EmptyNetwork: "line 2, column 1: network field is empty, row: ',,,,'",
 				},
 			},
 			em:      ErrInvalidGeofeed,
@@ -164,11 +193,12 @@ func TestProcessGeofeed_Invalid(t *testing.T) {
 			gf: "test_data/geofeed-invalid-network.csv",
 			db: "test_data/GeoIP2-City-Test.mmdb",
 			c: CheckResult{
-				Total:       2,
-				Differences: 1,
-				Invalid:     1,
+				Total:            2,
+				Differences:      1,
+				DifferenceCounts: DifferenceCounts{Country: 1, Region: 1, City: 1, PostalCode: 1},
+				Invalid:          1,
 				SampleInvalidRows: map[RowInvalidity]string{
-					UnableToParseNetwork: `line 1: unable to parse network 2a02:/29: netip.ParsePrefix("2a02:/29"): ParseAddr("2a02:"): colon must be followed by more characters (at ":")`,
+					UnableToParseNetwork: `line 1, column 1: unable to parse network 2a02:/29: netip.ParsePrefix("2a02:/29"): ParseAddr("2a02:"): colon must be followed by more characters (at ":")`,
 				},
 			},
 			em:      ErrInvalidGeofeed,
@@ -179,11 +209,12 @@ func TestProcessGeofeed_Invalid(t *testing.T) {
 			gf: "test_data/geofeed-valid-lax.csv",
 			db: "test_data/GeoIP2-City-Test.mmdb",
 			c: CheckResult{
-				Total:       3,
-				Differences: 1,
-				Invalid:     2,
+				Total:            3,
+				Differences:      1,
+				DifferenceCounts: DifferenceCounts{Country: 1, Region: 1, City: 1, PostalCode: 1},
+				Invalid:          2,
 				SampleInvalidRows: map[RowInvalidity]string{
-					InvalidRegionCode: "line 1: invalid ISO 3166-2 region code format " +
+					InvalidRegionCode: "line 1, column 22: invalid ISO 3166-2 region code format " +
 						"in strict (default) mode, row: '2a02:ecc0::/29,US,NJ,Parsippany,'",
 				},
 			},
@@ -220,12 +251,121 @@ func TestProcessGeofeed_Invalid(t *testing.T) {
 					test.em,
 					"got expected error: %s", test.em,
 				)
+				if test.db == cityTestDatabase {
+					test.c.Database = cityTestDatabaseInfo
+				}
 				assert.Equal(t, test.c, c)
 			},
 		)
 	}
 }
 
+func TestProcessGeofeed_RowErrors(t *testing.T) {
+	_, _, _, err := ProcessGeofeed(
+		"test_data/geofeed-valid-lax.csv",
+		"test_data/GeoIP2-City-Test.mmdb",
+		"",
+		Options{},
+	)
+	require.ErrorIs(t, err, ErrInvalidGeofeed)
+	assert.EqualError(
+		t,
+		err,
+		"geofeed does not comply with the RFC 8805 standards: 2 invalid rows",
+	)
+
+	var rowErr *RowError
+	require.ErrorAs(t, err, &rowErr)
+	assert.Equal(
+		t,
+		&RowError{
+			Line:       1,
+			Column:     22,
+			Field:      2,
+			Invalidity: InvalidRegionCode,
+			Value:      "NJ",
+			Row:        []string{"2a02:ecc0::/29", "US", "NJ", "Parsippany", ""},
+			Reason: "invalid ISO 3166-2 region code format in strict (default) mode, " +
+				"row: '2a02:ecc0::/29,US,NJ,Parsippany,'",
+		},
+		rowErr,
+	)
+
+	var invalidErr *InvalidGeofeedError
+	require.ErrorAs(t, err, &invalidErr)
+	require.Len(t, invalidErr.Rows, 2)
+	for _, rowErr := range invalidErr.Rows {
+		assert.Equal(t, InvalidRegionCode, rowErr.Invalidity)
+	}
+	assert.Less(t, invalidErr.Rows[0].Line, invalidErr.Rows[1].Line)
+	assert.Equal(t, 2, invalidErr.Invalid)
+}
+
+func TestProcessGeofeed_MaxInvalidRowErrors(t *testing.T) {
+	invalid := MaxInvalidRowErrors + 500
+	gf := filepath.Join(t.TempDir(), "geofeed.csv")
+	require.NoError(t, os.WriteFile(
+		gf,
+		[]byte(strings.Repeat("10.0.0.1/32,US,US-NJ\n", invalid)),
+		0o600,
+	))
+
+	c, _, _, err := ProcessGeofeed(gf, "", "", Options{})
+	require.ErrorIs(t, err, ErrInvalidGeofeed)
+	assert.Equal(t, invalid, c.Invalid)
+	assert.EqualError(t, err, fmt.Sprintf("%s: %d invalid rows", ErrInvalidGeofeed, invalid))
+
+	var invalidErr *InvalidGeofeedError
+	require.ErrorAs(t, err, &invalidErr)
+	assert.Equal(t, invalid, invalidErr.Invalid)
+	require.Len(t, invalidErr.Rows, MaxInvalidRowErrors)
+	assert.Equal(t, MaxInvalidRowErrors, invalidErr.Rows[MaxInvalidRowErrors-1].Line)
+}
+
+func TestProcessGeofeed_LinePositions(t *testing.T) {
+	var lines []int
+	_, _, err := StreamGeofeed(
+		context.Background(),
+		"test_data/geofeed-invalid-comments.csv",
+		"",
+		"",
+		Options{},
+		func(r RowResult) error {
+			lines = append(lines, r.Line)
+			return nil
+		},
+	)
+	require.ErrorIs(t, err, ErrInvalidGeofeed)
+	assert.Equal(t, []int{3, 6, 8, 9}, lines)
+
+	var invalidErr *InvalidGeofeedError
+	require.ErrorAs(t, err, &invalidErr)
+	require.Len(t, invalidErr.Rows, 3)
+
+	tests := []struct {
+		line   int
+		column int
+		field  int
+		value  string
+	}{
+		{line: 6, column: 22, field: 2, value: "9"},
+		{line: 8, column: 0, field: -1},
+		{line: 9, column: 3, field: 0, value: "not-a-network"},
+	}
+	for i, test := range tests {
+		rowErr := invalidErr.Rows[i]
+		assert.Equal(t, test.line, rowErr.Line, "row error %d line", i)
+		assert.Equal(t, test.column, rowErr.Column, "row error %d column", i)
+		assert.Equal(t, test.field, rowErr.Field, "row error %d field", i)
+		assert.Equal(t, test.value, rowErr.Value, "row error %d value", i)
+	}
+	assert.True(
+		t,
+		strings.HasPrefix(invalidErr.Rows[0].Error(), "line 6, column 22: "),
+		invalidErr.Rows[0].Error(),
+	)
+}
+
 func TestProcessGeofeed_FormatOnly(t *testing.T) {
 	t.Run("valid feed, format-only", func(t *testing.T) {
 		c, dl, asnCounts, err := ProcessGeofeed(
@@ -339,3 +479,710 @@ func TestProcessGeofeed_NonUTF8(t *testing.T) {
 		})
 	}
 }
+
+func TestStreamGeofeed_NotUTF8(t *testing.T) {
+	gf := filepath.Join(t.TempDir(), "geofeed.csv")
+	require.NoError(t, os.WriteFile(
+		gf,
+		[]byte("2.125.160.216/29,GB,GB-ENG,Boxford,\n"+
+			"81.2.69.142/32,GB,GB-ENG,\xffbad,\n"+
+			"216.160.83.56/29,US,US-WA,Milton,98354\n"),
+		0o600,
+	))
+
+	var results []RowResult
+	c, _, err := StreamGeofeed(
+		t.Context(),
+		gf,
+		"test_data/GeoIP2-City-Test.mmdb",
+		"",
+		Options{},
+		func(r RowResult) error {
+			results = append(results, r)
+			return nil
+		},
+	)
+	require.ErrorIs(t, err, ErrNotUTF8)
+	// The row with the invalid bytes and the rows after it are not processed.
+	assert.Equal(t, 1, c.Total)
+	require.Len(t, results, 1)
+	assert.Equal(t, 1, results[0].Line)
+}
+
+func TestProcessGeofeedContext_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c, _, _, err := ProcessGeofeedContext(
+		ctx,
+		"test_data/geofeed-valid.csv",
+		"test_data/GeoIP2-City-Test.mmdb",
+		"",
+		Options{},
+	)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, c.Total)
+}
+
+func TestProcessGeofeed_Progress(t *testing.T) {
+	var sb strings.Builder
+	for i := range 2500 {
+		fmt.Fprintf(&sb, "10.0.%d.%d/32,US,US-NJ,Parsippany,\n", i/256, i%256)
+	}
+	gf := filepath.Join(t.TempDir(), "geofeed.csv")
+	require.NoError(t, os.WriteFile(gf, []byte(sb.String()), 0o600))
+
+	var progress []Progress
+	c, _, _, err := ProcessGeofeed(
+		gf,
+		"",
+		"",
+		Options{Progress: func(p Progress) { progress = append(progress, p) }},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 2500, c.Total)
+
+	require.Len(t, progress, 3)
+	assert.Equal(t, 1000, progress[0].Rows)
+	assert.Equal(t, 2000, progress[1].Rows)
+	assert.Less(t, progress[0].Bytes, progress[1].Bytes)
+	assert.Equal(
+		t,
+		Progress{Rows: 2500, Bytes: int64(sb.Len()), TotalBytes: int64(sb.Len())},
+		progress[2],
+	)
+}
+
+// writeLargeGeofeed writes a geofeed with the given number of rows to a
+// temporary file and returns its path. Most rows are in networks found in the
+// test MMDB, with a mix of matching, differing and invalid rows.
+func writeLargeGeofeed(tb testing.TB, rows int) string {
+	networks := []struct {
+		prefix string
+		row    string
+	}{
+		{"81.2.69.%d/32", "GB,GB-ENG,London,"},
+		{"216.160.83.%d/32", "US,US-WA,Milton,98354"},
+		{"89.160.20.%d/32", "SE,SE-E,Linkoping,"},
+		{"175.16.199.%d/32", "CN,CN-22,Changchun,"},
+		{"198.51.100.%d/32", "US,US-NY,New York,"},
+	}
+
+	r := rand.New(rand.NewPCG(1, 2)) //nolint:gosec // not security sensitive
+	var sb strings.Builder
+	for i := range rows {
+		if i%97 == 0 {
+			sb.WriteString("10.0.0.1/32,US,US-NJ\n")
+			continue
+		}
+		n := networks[r.IntN(len(networks))]
+		fmt.Fprintf(&sb, n.prefix+","+n.row+"\n", 128+r.IntN(128))
+	}
+
+	gf := filepath.Join(tb.TempDir(), "geofeed.csv")
+	require.NoError(tb, os.WriteFile(gf, []byte(sb.String()), 0o600))
+	return gf
+}
+
+// writeTestMMDB writes an MMDB with the given records, keyed by network, to a
+// temporary file and returns its path.
+func writeTestMMDB(tb testing.TB, opts mmdbwriter.Options, records map[string]mmdbtype.Map) string {
+	opts.IncludeReservedNetworks = true
+	tree, err := mmdbwriter.New(opts)
+	require.NoError(tb, err)
+	for network, record := range records {
+		_, ipNet, err := net.ParseCIDR(network)
+		require.NoError(tb, err)
+		require.NoError(tb, tree.Insert(ipNet, record))
+	}
+
+	path := filepath.Join(tb.TempDir(), opts.DatabaseType+".mmdb")
+	f, err := os.Create(path)
+	require.NoError(tb, err)
+	defer f.Close()
+	_, err = tree.WriteTo(f)
+	require.NoError(tb, err)
+	return path
+}
+
+// countryRecord returns a Country record for the country code.
+func countryRecord(isoCode string) mmdbtype.Map {
+	return locationRecord(Location{Country: isoCode})
+}
+
+// writeMatchingTestMMDB writes a City MMDB that matches every row of
+// test_data/geofeed-valid.csv and returns its path.
+func writeMatchingTestMMDB(tb testing.TB) string {
+	return writeTestMMDB(
+		tb,
+		mmdbwriter.Options{DatabaseType: "GeoIP2-City"},
+		map[string]mmdbtype.Map{
+			"2a02:ecc0::/29": locationRecord(
+				Location{Country: "US", Region: "US-NJ", City: "Parsippany"},
+			),
+			"202.196.224.0/22": locationRecord(
+				Location{Country: "AT", Region: "AT-9", City: "Vienna", PostalCode: "1060"},
+			),
+			"2.125.160.216/29": locationRecord(
+				Location{Country: "GB", Region: "GB-WBK", City: "Boxford"},
+			),
+		},
+	)
+}
+
+func TestProcessGeofeed_Concurrency(t *testing.T) {
+	gf := writeLargeGeofeed(t, 10_000)
+
+	expectedC, expectedDL, expectedASNCounts, expectedErr := ProcessGeofeed(
+		gf,
+		"test_data/GeoIP2-City-Test.mmdb",
+		"",
+		Options{},
+	)
+	require.ErrorIs(t, expectedErr, ErrInvalidGeofeed)
+	require.NotZero(t, expectedC.Differences)
+
+	for _, concurrency := range []int{2, 4, 16} {
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			c, dl, asnCounts, err := ProcessGeofeed(
+				gf,
+				"test_data/GeoIP2-City-Test.mmdb",
+				"",
+				Options{Concurrency: concurrency},
+			)
+			require.ErrorIs(t, err, ErrInvalidGeofeed)
+			assert.Equal(t, expectedC, c)
+			assert.Equal(t, expectedDL, dl)
+			assert.Equal(t, expectedASNCounts, asnCounts)
+		})
+	}
+}
+
+func TestProcessGeofeedContext_CanceledConcurrent(t *testing.T) {
+	gf := writeLargeGeofeed(t, 10_000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, _, _, err := ProcessGeofeedContext(
+		ctx,
+		gf,
+		"test_data/GeoIP2-City-Test.mmdb",
+		"",
+		Options{
+			Concurrency: 4,
+			Progress: func(p Progress) {
+				if p.Rows >= 2000 {
+					cancel()
+				}
+			},
+		},
+	)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, c.Total, 10_000)
+}
+
+func BenchmarkProcessGeofeed(b *testing.B) {
+	gf := writeLargeGeofeed(b, 200_000)
+
+	for _, concurrency := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for b.Loop() {
+				_, _, _, err := ProcessGeofeed(
+					gf,
+					"test_data/GeoIP2-City-Test.mmdb",
+					"",
+					Options{Concurrency: concurrency},
+				)
+				require.ErrorIs(b, err, ErrInvalidGeofeed)
+			}
+		})
+	}
+}
+
+func TestStreamGeofeed(t *testing.T) {
+	var results []RowResult
+	c, _, err := StreamGeofeed(
+		context.Background(),
+		"test_data/geofeed-invalid-empty-network.csv",
+		"test_data/GeoIP2-City-Test.mmdb",
+		"",
+		Options{},
+		func(r RowResult) error {
+			results = append(results, r)
+			return nil
+		},
+	)
+	require.ErrorIs(t, err, ErrInvalidGeofeed)
+	assert.Equal(t, 2, c.Total)
+
+	require.Len(t, results, 2)
+	assert.Equal(t, 1, results[0].Line)
+	assert.Nil(t, results[0].Err)
+	assert.Contains(t, results[0].Diff, "Found a potential improvement: '2a02:ecc0::/29'")
+	require.NotNil(t, results[0].Comparison)
+	assert.Equal(
+		t,
+		[]Field{CountryField, RegionField, CityField, PostalCodeField},
+		results[0].Comparison.Differences,
+	)
+	assert.Equal(t, "US-NJ", results[0].Comparison.Suggested.Region)
+	assert.Equal(t, "AZ", results[0].Comparison.Current.Country)
+	assert.Equal(
+		t,
+		RowResult{
+			Line: 2,
+			Row:  []string{"", "", "", "", ""},
+			Err: &RowError{
+				Line:       2,
+				Column:     1,
+				Field:      0,
+				Invalidity: EmptyNetwork,
+				Row:        []string{"", "", "", "", ""},
+				Reason:     "network field is empty, row: ',,,,'",
+			},
+		},
+		results[1],
+	)
+}
+
+func TestStreamGeofeed_HandleError(t *testing.T) {
+	errStop := errors.New("stop")
+	rows := 0
+	c, _, err := StreamGeofeed(
+		context.Background(),
+		writeLargeGeofeed(t, 1000),
+		"test_data/GeoIP2-City-Test.mmdb",
+		"",
+		Options{Concurrency: 4},
+		func(RowResult) error {
+			rows++
+			if rows == 10 {
+				return errStop
+			}
+			return nil
+		},
+	)
+	require.ErrorIs(t, err, errStop)
+	assert.Equal(t, 10, rows)
+	assert.Equal(t, 10, c.Total)
+}
+
+func TestRowResults(t *testing.T) {
+	t.Run("all rows", func(t *testing.T) {
+		var (
+			lines []int
+			errs  []error
+		)
+		for r, err := range RowResults(
+			context.Background(),
+			"test_data/geofeed-invalid-empty-network.csv",
+			"test_data/GeoIP2-City-Test.mmdb",
+			"",
+			Options{},
+		) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			lines = append(lines, r.Line)
+		}
+		assert.Equal(t, []int{1, 2}, lines)
+		require.Len(t, errs, 1)
+		require.ErrorIs(t, errs[0], ErrInvalidGeofeed)
+	})
+
+	t.Run("stop early", func(t *testing.T) {
+		rows := 0
+		for r, err := range RowResults(
+			context.Background(),
+			writeLargeGeofeed(t, 1000),
+			"test_data/GeoIP2-City-Test.mmdb",
+			"",
+			Options{Concurrency: 4},
+		) {
+			require.NoError(t, err)
+			rows++
+			if r.Diff != "" {
+				break
+			}
+		}
+		assert.Less(t, rows, 1000)
+	})
+
+	t.Run("missing geofeed", func(t *testing.T) {
+		var errs []error
+		for _, err := range RowResults(
+			context.Background(),
+			"test_data/does-not-exist.csv",
+			"",
+			"",
+			Options{},
+		) {
+			errs = append(errs, err)
+		}
+		require.Len(t, errs, 1)
+		require.ErrorContains(t, errs[0], "unable to open")
+	})
+}
+
+func TestProcessGeofeed_CityEquivalent(t *testing.T) {
+	for _, exact := range []bool{false, true} {
+		var comparisons []*Comparison
+		c, _, err := StreamGeofeed(
+			context.Background(),
+			"test_data/geofeed-city-equivalent.csv",
+			"test_data/GeoIP2-City-Test.mmdb",
+			"",
+			Options{ExactCityMatch: exact},
+			func(r RowResult) error {
+				comparisons = append(comparisons, r.Comparison)
+				return nil
+			},
+		)
+		require.NoError(t, err)
+		require.Len(t, comparisons, 2)
+
+		assert.Equal(t, CityEquivalent, comparisons[0].CityMatch)
+		assert.Equal(t, CityExact, comparisons[1].CityMatch)
+		assert.Empty(t, comparisons[1].Differences)
+		if exact {
+			assert.Equal(t, 1, c.Differences)
+			assert.Equal(t, []Field{CityField}, comparisons[0].Differences)
+		} else {
+			assert.Equal(t, 0, c.Differences)
+			assert.Empty(t, comparisons[0].Differences)
+		}
+	}
+}
+
+func TestProcessGeofeed_CityLocales(t *testing.T) {
+	tests := []struct {
+		locale  string
+		current []string
+	}{
+		{"", []string{"Changchun", "London", "Milton"}},
+		{"de", []string{"Chángchūn", "London", "Milton"}},
+		{"ru", []string{"Чанчунь", "Лондон", "Мильтон"}},
+	}
+	for _, test := range tests {
+		t.Run(test.locale, func(t *testing.T) {
+			var comparisons []*Comparison
+			c, _, err := StreamGeofeed(
+				t.Context(),
+				"test_data/geofeed-city-locales.csv",
+				"test_data/GeoIP2-City-Test.mmdb",
+				"",
+				Options{Locale: test.locale},
+				func(r RowResult) error {
+					comparisons = append(comparisons, r.Comparison)
+					return nil
+				},
+			)
+			require.NoError(t, err)
+			require.Len(t, comparisons, 3)
+			assert.Equal(t, 1, c.Differences)
+
+			var current []string
+			for _, comparison := range comparisons {
+				current = append(current, comparison.Current.City)
+			}
+			assert.Equal(t, test.current, current)
+
+			assert.Equal(t, CityExact, comparisons[0].CityMatch)
+			assert.Equal(t, "zh-CN", comparisons[0].CityLocale)
+			assert.Empty(t, comparisons[0].Differences)
+			// "Londres" is the name in several locales; the first in
+			// alphabetical order is reported.
+			assert.Equal(t, "es", comparisons[1].CityLocale)
+			assert.Empty(t, comparisons[1].Differences)
+			assert.Equal(t, CityMismatch, comparisons[2].CityMatch)
+			assert.Empty(t, comparisons[2].CityLocale)
+			assert.Equal(t, []Field{CityField}, comparisons[2].Differences)
+		})
+	}
+}
+
+func TestProcessGeofeed_RegionLevels(t *testing.T) {
+	var comparisons []*Comparison
+	c, _, err := StreamGeofeed(
+		t.Context(),
+		"test_data/geofeed-region-levels.csv",
+		"test_data/GeoIP2-City-Test.mmdb",
+		"",
+		Options{LaxMode: true},
+		func(r RowResult) error {
+			comparisons = append(comparisons, r.Comparison)
+			return nil
+		},
+	)
+	require.NoError(t, err)
+	require.Len(t, comparisons, 5)
+	assert.Equal(t, 2, c.Differences)
+
+	tests := []struct {
+		match       RegionMatch
+		level       int
+		region      string
+		differences []Field
+	}{
+		{RegionParent, 1, "GB-WBK", nil},
+		{RegionExact, 2, "GB-WBK", nil},
+		{RegionParent, 1, "WBK", nil},
+		{RegionMismatch, 0, "GB-ENG", []Field{RegionField}},
+		// The MMDB has no subdivision for this network.
+		{RegionMismatch, 0, "", []Field{RegionField}},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.match, comparisons[i].RegionMatch, "row %d", i+1)
+		assert.Equal(t, test.level, comparisons[i].RegionLevel, "row %d", i+1)
+		assert.Equal(t, test.region, comparisons[i].Current.Region, "row %d", i+1)
+		assert.Equal(t, test.differences, comparisons[i].Differences, "row %d", i+1)
+	}
+}
+
+func TestProcessGeofeed_DifferenceCounts(t *testing.T) {
+	c, _, _, err := ProcessGeofeed(
+		"test_data/geofeed-field-differences.csv",
+		"test_data/GeoIP2-City-Test.mmdb",
+		"",
+		Options{},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 4, c.Differences)
+	assert.Equal(
+		t,
+		DifferenceCounts{Country: 1, City: 2, PostalCode: 1, CityOnly: 2},
+		c.DifferenceCounts,
+	)
+}
+
+func TestProcessGeofeed_Distance(t *testing.T) {
+	f, err := os.Open("test_data/gazetteer.csv")
+	require.NoError(t, err)
+	defer f.Close()
+	g, err := ReadGazetteer(f)
+	require.NoError(t, err)
+
+	for _, minDistance := range []float64{0, 50} {
+		var comparisons []*Comparison
+		c, _, err := StreamGeofeed(
+			t.Context(),
+			"test_data/geofeed-distance.csv",
+			"test_data/GeoIP2-City-Test.mmdb",
+			"",
+			Options{Gazetteer: g, MinDistance: minDistance},
+			func(r RowResult) error {
+				comparisons = append(comparisons, r.Comparison)
+				return nil
+			},
+		)
+		require.NoError(t, err)
+		require.Len(t, comparisons, 5)
+
+		require.NotNil(t, comparisons[0].Distance)
+		assert.InDelta(t, 39.5, *comparisons[0].Distance, 0.5)
+		assert.Equal(t, uint16(22), comparisons[0].AccuracyRadius)
+		require.NotNil(t, comparisons[1].Distance)
+		assert.InDelta(t, 61.6, *comparisons[1].Distance, 0.5)
+		assert.Contains(t, comparisons[1].diff(), "Distance: 61.")
+		require.NotNil(t, comparisons[2].Distance)
+		// Norrköping is not in the gazetteer.
+		assert.Nil(t, comparisons[3].Distance)
+		assert.Zero(t, comparisons[3].AccuracyRadius)
+
+		assert.Equal(t, []Field{CityField}, comparisons[1].Differences)
+		assert.Equal(t, []Field{CityField}, comparisons[3].Differences)
+		// The country differs, so the row is reported regardless of the
+		// distance.
+		assert.Contains(t, comparisons[2].Differences, CountryField)
+		if minDistance == 0 {
+			assert.Equal(t, 5, c.Differences)
+			assert.Equal(t, []Field{CityField}, comparisons[0].Differences)
+			assert.Equal(t, []Field{CityField, PostalCodeField}, comparisons[4].Differences)
+		} else {
+			assert.Equal(t, 4, c.Differences)
+			assert.Empty(t, comparisons[0].Differences)
+			// Only the city is close enough, the postal code still differs.
+			assert.Equal(t, []Field{PostalCodeField}, comparisons[4].Differences)
+		}
+	}
+}
+
+func TestProcessGeofeed_CountryDatabase(t *testing.T) {
+	for _, dbType := range []string{"GeoIP2-Country", "GeoLite2-Country"} {
+		t.Run(dbType, func(t *testing.T) {
+			db := writeTestMMDB(
+				t,
+				mmdbwriter.Options{DatabaseType: dbType},
+				map[string]mmdbtype.Map{
+					"2a02:ecc0::/29":   countryRecord("US"),
+					"202.196.224.0/20": countryRecord("PH"),
+					"2.125.160.216/29": countryRecord("GB"),
+				},
+			)
+
+			var comparisons []*Comparison
+			c, _, err := StreamGeofeed(
+				t.Context(),
+				"test_data/geofeed-valid.csv",
+				db,
+				"",
+				Options{},
+				func(r RowResult) error {
+					comparisons = append(comparisons, r.Comparison)
+					return nil
+				},
+			)
+			require.NoError(t, err)
+			require.Len(t, comparisons, 3)
+			assert.Equal(t, 1, c.Differences)
+
+			assert.Empty(t, comparisons[0].Differences)
+			assert.Equal(t, []Field{CountryField}, comparisons[1].Differences)
+			assert.Equal(t, "PH", comparisons[1].Current.Country)
+			assert.Empty(t, comparisons[2].Differences)
+		})
+	}
+}
+
+func TestProcessGeofeed_CustomDatabase(t *testing.T) {
+	db := writeTestMMDB(
+		t,
+		mmdbwriter.Options{DatabaseType: "Example-Geofeed-Overlay"},
+		map[string]mmdbtype.Map{
+			"2a02:ecc0::/29": locationRecord(Location{Country: "US", City: "Phoenix"}),
+		},
+	)
+
+	c, _, _, err := ProcessGeofeed("test_data/geofeed-valid.csv", db, "", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, c.Differences)
+	require.NotNil(t, c.Database)
+	assert.Equal(
+		t,
+		[]Field{CountryField, RegionField, CityField, PostalCodeField},
+		databaseFields(c.Database.DatabaseType),
+	)
+}
+
+func TestProcessGeofeed_ASNDatabase(t *testing.T) {
+	asn := writeTestMMDB(
+		t,
+		mmdbwriter.Options{DatabaseType: "GeoLite2-ASN"},
+		map[string]mmdbtype.Map{
+			"2a02:ecc0::/29": {
+				"autonomous_system_number":       mmdbtype.Uint32(64500),
+				"autonomous_system_organization": mmdbtype.String("Example Networks"),
+			},
+			"202.196.224.0/20": {
+				"autonomous_system_number":       mmdbtype.Uint32(64501),
+				"autonomous_system_organization": mmdbtype.String("Example Transit"),
+			},
+			"2.125.160.216/29": {
+				"autonomous_system_number":       mmdbtype.Uint32(64500),
+				"autonomous_system_organization": mmdbtype.String("Example Networks"),
+			},
+		},
+	)
+
+	var comparisons []*Comparison
+	c, asnCounts, err := StreamGeofeed(
+		t.Context(),
+		"test_data/geofeed-valid.csv",
+		"test_data/GeoIP2-City-Test.mmdb",
+		asn,
+		Options{},
+		func(r RowResult) error {
+			comparisons = append(comparisons, r.Comparison)
+			return nil
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, map[uint]int{64500: 2, 64501: 1}, asnCounts)
+	require.NotNil(t, c.ISPDatabase)
+	assert.Equal(t, "GeoLite2-ASN", c.ISPDatabase.DatabaseType)
+	require.Len(t, comparisons, 3)
+	assert.Equal(t, uint(64501), comparisons[1].ASNumber)
+	assert.Equal(t, "Example Transit", comparisons[1].ASOrganization)
+	assert.Empty(t, comparisons[1].ISP)
+	assert.Contains(t, comparisons[1].diff(), "AS Name: Example Transit")
+}
+
+func TestProcessGeofeed_UnsupportedDatabase(t *testing.T) {
+	asn := writeTestMMDB(
+		t,
+		mmdbwriter.Options{DatabaseType: "GeoLite2-ASN"},
+		map[string]mmdbtype.Map{
+			"2a02:ecc0::/29": {"autonomous_system_number": mmdbtype.Uint32(64500)},
+		},
+	)
+
+	anonymous := writeTestMMDB(
+		t,
+		mmdbwriter.Options{DatabaseType: "GeoIP2-Anonymous-IP"},
+		map[string]mmdbtype.Map{
+			"2a02:ecc0::/29": {"is_anonymous": mmdbtype.Bool(true)},
+		},
+	)
+
+	connectionType := writeTestMMDB(
+		t,
+		mmdbwriter.Options{DatabaseType: "GeoIP2-Connection-Type"},
+		map[string]mmdbtype.Map{
+			"2a02:ecc0::/29": {"connection_type": mmdbtype.String("Cable/DSL")},
+		},
+	)
+
+	tests := []struct {
+		desc string
+		db   string
+		isp  string
+		msg  string
+	}{
+		{
+			"Connection type database as City database",
+			connectionType,
+			"",
+			"unsupported database type for the MMDB " + connectionType +
+				": GeoIP2-Connection-Type",
+		},
+		{
+			"Anonymous IP database as City database",
+			anonymous,
+			"",
+			"unsupported database type for the MMDB " + anonymous + ": GeoIP2-Anonymous-IP",
+		},
+		{
+			"ASN database as City database",
+			asn,
+			"",
+			"unsupported database type for the MMDB " + asn + ": GeoLite2-ASN",
+		},
+		{
+			"City database as ISP database",
+			"test_data/GeoIP2-City-Test.mmdb",
+			"test_data/GeoIP2-City-Test.mmdb",
+			"unsupported database type for the ISP MMDB " +
+				"test_data/GeoIP2-City-Test.mmdb: GeoIP2-City",
+		},
+		{
+			"Anonymous IP database as ISP database",
+			"test_data/GeoIP2-City-Test.mmdb",
+			anonymous,
+			"unsupported database type for the ISP MMDB " + anonymous + ": GeoIP2-Anonymous-IP",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, _, _, err := ProcessGeofeed(
+				"test_data/geofeed-valid.csv",
+				test.db,
+				test.isp,
+				Options{},
+			)
+			require.ErrorIs(t, err, ErrUnsupportedDatabase)
+			assert.EqualError(t, err, test.msg)
+		})
+	}
+}